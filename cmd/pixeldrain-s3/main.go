@@ -0,0 +1,52 @@
+// Command pixeldrain-s3 serves pixeldrain filesystem buckets over a subset of
+// the S3 API. Credentials are read from a JSON file which maps access key IDs
+// to a secret key and a pixeldrain API key:
+//
+//	{"AKEXAMPLE": {"secret_key": "...", "api_key": "..."}}
+//
+// Without a credentials file a single credential is read from the
+// S3_ACCESS_KEY, S3_SECRET_KEY and PIXELDRAIN_API_KEY environment variables.
+// Clients must use path-style addressing:
+//
+//	aws --endpoint-url http://127.0.0.1:9000 s3 ls s3://me/
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"fornaxian.tech/pixeldrain_api_client/pixelapi"
+	"fornaxian.tech/pixeldrain_api_client/s3gw"
+)
+
+func main() {
+	var listen = flag.String("listen", "127.0.0.1:9000", "Address to serve the S3 API on")
+	var endpoint = flag.String("api", "https://pixeldrain.com/api", "Pixeldrain API endpoint")
+	var credFile = flag.String("credentials", "", "JSON file with S3 credentials")
+	flag.Parse()
+
+	var creds = make(map[string]s3gw.Credential)
+	if *credFile != "" {
+		data, err := os.ReadFile(*credFile)
+		if err != nil {
+			log.Fatal(err)
+		} else if err = json.Unmarshal(data, &creds); err != nil {
+			log.Fatalf("Failed to parse credentials file: %s", err)
+		}
+	} else {
+		var access, secret, key = os.Getenv("S3_ACCESS_KEY"), os.Getenv("S3_SECRET_KEY"), os.Getenv("PIXELDRAIN_API_KEY")
+		if access == "" || secret == "" || key == "" {
+			log.Fatal("Pass -credentials or set S3_ACCESS_KEY, S3_SECRET_KEY and PIXELDRAIN_API_KEY")
+		}
+		creds[access] = s3gw.Credential{SecretKey: secret, APIKey: key}
+	}
+
+	var gateway = s3gw.New(pixelapi.New(*endpoint), creds)
+	gateway.Logger = log.Default()
+
+	log.Printf("Serving S3 API on http://%s", *listen)
+	log.Fatal(http.ListenAndServe(*listen, gateway))
+}
@@ -0,0 +1,79 @@
+// Command pixeldrain-sftp serves pixeldrain filesystem buckets over SFTP. Users
+// are read from a JSON file which maps user names to a password or authorized
+// keys and the pixeldrain API key of the user:
+//
+//	{"partner": {"password": "...", "api_key": "...", "root": "/me/incoming"}}
+//
+// The host key is read from the -host-key file. If the file does not exist a
+// new ed25519 key is generated and saved there.
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"io/fs"
+	"log"
+	"os"
+
+	"fornaxian.tech/pixeldrain_api_client/pixelapi"
+	"fornaxian.tech/pixeldrain_api_client/sftpgw"
+	"golang.org/x/crypto/ssh"
+)
+
+func main() {
+	var listen = flag.String("listen", "127.0.0.1:2022", "Address to serve SFTP on")
+	var endpoint = flag.String("api", "https://pixeldrain.com/api", "Pixeldrain API endpoint")
+	var usersFile = flag.String("users", "users.json", "JSON file with SFTP users")
+	var hostKeyFile = flag.String("host-key", "host_key", "Private key file of the server")
+	flag.Parse()
+
+	var users map[string]sftpgw.User
+	data, err := os.ReadFile(*usersFile)
+	if err != nil {
+		log.Fatal(err)
+	} else if err = json.Unmarshal(data, &users); err != nil {
+		log.Fatalf("Failed to parse users file: %s", err)
+	}
+
+	hostKey, err := loadHostKey(*hostKeyFile)
+	if err != nil {
+		log.Fatalf("Failed to load host key: %s", err)
+	}
+
+	server, err := sftpgw.New(pixelapi.New(*endpoint), users, hostKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	server.Logger = log.Default()
+
+	log.Printf("Serving SFTP on %s, host key %s", *listen, ssh.FingerprintSHA256(hostKey.PublicKey()))
+	log.Fatal(server.ListenAndServe(*listen))
+}
+
+// loadHostKey reads a private key, or generates one if the file does not exist
+func loadHostKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return ssh.ParsePrivateKey(data)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	block, err := ssh.MarshalPrivateKey(key, "pixeldrain-sftp")
+	if err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		return nil, err
+	}
+	log.Printf("Generated new host key in %s", path)
+	return ssh.NewSignerFromKey(key)
+}
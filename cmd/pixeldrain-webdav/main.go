@@ -0,0 +1,43 @@
+// Command pixeldrain-webdav serves pixeldrain filesystem buckets over WebDAV,
+// so they can be mounted in a file manager. The API key is read from the
+// PIXELDRAIN_API_KEY environment variable.
+//
+//	PIXELDRAIN_API_KEY=... pixeldrain-webdav -listen 127.0.0.1:8080 -root /me
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"fornaxian.tech/pixeldrain_api_client/davfs"
+	"fornaxian.tech/pixeldrain_api_client/pixelapi"
+)
+
+func main() {
+	var listen = flag.String("listen", "127.0.0.1:8080", "Address to serve WebDAV on")
+	var endpoint = flag.String("api", "https://pixeldrain.com/api", "Pixeldrain API endpoint")
+	var root = flag.String("root", "/", "Filesystem path to serve, / serves all buckets")
+	var ttl = flag.Duration("cache", 10*time.Second, "How long directory listings are cached")
+	flag.Parse()
+
+	var key = os.Getenv("PIXELDRAIN_API_KEY")
+	if key == "" {
+		log.Fatal("PIXELDRAIN_API_KEY is not set")
+	}
+
+	handler, err := davfs.NewHandler(pixelapi.New(*endpoint).Login(key), *root, "", *ttl)
+	if err != nil {
+		log.Fatal(err)
+	}
+	handler.Logger = func(r *http.Request, err error) {
+		if err != nil {
+			log.Printf("%s %s: %s", r.Method, r.URL.Path, err)
+		}
+	}
+
+	log.Printf("Serving %s over WebDAV on http://%s", *root, *listen)
+	log.Fatal(http.ListenAndServe(*listen, handler))
+}
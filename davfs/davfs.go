@@ -0,0 +1,467 @@
+// Package davfs serves pixeldrain filesystem buckets over WebDAV. FileSystem
+// implements webdav.FileSystem on top of the filesystem API, so it can be used
+// with webdav.Handler to mount buckets in file managers
+package davfs
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"fornaxian.tech/pixeldrain_api_client/pixelapi"
+	"golang.org/x/net/webdav"
+)
+
+// Namespace is the XML namespace of the pixeldrain specific DAV properties
+const Namespace = "https://pixeldrain.com/ns/dav"
+
+// FileSystem is a webdav.FileSystem backed by the pixeldrain filesystem API.
+// Reads go through a pixelapi.FS, so directory listings are cached for a short
+// time. Changes made through FileSystem invalidate the cache
+type FileSystem struct {
+	api  pixelapi.PixelAPI
+	root pixelapi.FSPath
+	fs   *pixelapi.FS
+}
+
+// New creates a FileSystem rooted at a filesystem path. If root is "/" the
+// buckets of the user are the top level directories. Directory listings are
+// cached for ttl
+func New(api pixelapi.PixelAPI, root string, ttl time.Duration) (*FileSystem, error) {
+	fsp, err := pixelapi.ParseFSPath(root)
+	if err != nil {
+		return nil, err
+	}
+	fsys, err := pixelapi.NewFS(api, root, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSystem{api: api, root: fsp, fs: fsys}, nil
+}
+
+// NewHandler returns a WebDAV handler serving a FileSystem with an in-memory
+// lock system. prefix is the URL path the handler is mounted at
+func NewHandler(api pixelapi.PixelAPI, root, prefix string, ttl time.Duration) (*webdav.Handler, error) {
+	fsys, err := New(api, root, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return &webdav.Handler{
+		Prefix:     prefix,
+		FileSystem: fsys,
+		LockSystem: webdav.NewMemLS(),
+	}, nil
+}
+
+// fsName converts a WebDAV name to a name for pixelapi.FS
+func fsName(name string) string {
+	name = strings.Trim(name, "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// parentName returns the pixelapi.FS name of the parent directory of a WebDAV
+// name
+func parentName(name string) string {
+	return fsName(path.Dir(strings.Trim(name, "/")))
+}
+
+// apiPath converts a WebDAV name to a filesystem path
+func (f *FileSystem) apiPath(op, name string) (pixelapi.FSPath, error) {
+	name = strings.Trim(name, "/")
+	if name == "" {
+		return f.root, nil
+	}
+	fsp, err := f.root.Join(strings.Split(name, "/")...)
+	if err != nil {
+		return fsp, &os.PathError{Op: op, Path: name, Err: os.ErrInvalid}
+	}
+	return fsp, nil
+}
+
+// pathError converts an API error into an *os.PathError. The webdav package
+// checks errors with os.IsNotExist, which does not look into wrapped errors, so
+// the well known errors are replaced by their os equivalents
+func pathError(op, name string, err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		err = os.ErrNotExist
+	case errors.Is(err, fs.ErrExist):
+		err = os.ErrExist
+	case errors.Is(err, fs.ErrPermission):
+		err = os.ErrPermission
+	}
+	var perr *fs.PathError
+	if errors.As(err, &perr) {
+		err = perr.Err
+	}
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+// Mkdir implements webdav.FileSystem
+func (f *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	fsp, err := f.apiPath("mkdir", name)
+	if err != nil {
+		return err
+	}
+
+	// The API only has mkdirall, so check the parent and the target first to
+	// get the behaviour of os.Mkdir
+	if parent, err := f.fs.Stat(parentName(name)); err != nil {
+		return pathError("mkdir", name, err)
+	} else if !parent.IsDir() {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrNotExist}
+	}
+	if _, err := f.fs.Stat(fsName(name)); err == nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+
+	defer f.fs.Invalidate(fsName(name))
+	if _, err = f.api.MkdirAllFilesystem(fsp.String()); err != nil {
+		return pathError("mkdir", name, err)
+	}
+	return nil
+}
+
+// OpenFile implements webdav.FileSystem. Files opened for writing are uploaded
+// while they are written, the upload finishes when the file is closed. Writing
+// always replaces the whole file, appending and writing at offsets is not
+// supported
+func (f *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		file, err := f.fs.Open(fsName(name))
+		if err != nil {
+			return nil, pathError("open", name, err)
+		}
+		return &davFile{File: file}, nil
+	}
+
+	fsp, err := f.apiPath("open", name)
+	if err != nil {
+		return nil, err
+	} else if len(fsp.Segments()) < 2 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+	}
+	if flag&os.O_APPEND != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: errors.ErrUnsupported}
+	}
+
+	existing, err := f.fs.Stat(fsName(name))
+	switch {
+	case err == nil && flag&os.O_EXCL != 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	case err == nil && existing.IsDir():
+		return nil, &os.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		return nil, pathError("open", name, err)
+	case err != nil && flag&os.O_CREATE == 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+
+	// The upload only fails when the file is closed, so make sure the parent
+	// directory exists now. Otherwise the client would get the wrong status
+	if parent, err := f.fs.Stat(parentName(name)); err != nil {
+		return nil, pathError("open", name, err)
+	} else if !parent.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+
+	return f.upload(ctx, fsp, name), nil
+}
+
+// upload starts uploading a file and returns the file the upload reads from.
+// The upload is aborted instead of committed if ctx is canceled before the file
+// is closed
+func (f *FileSystem) upload(ctx context.Context, fsp pixelapi.FSPath, name string) *uploadFile {
+	pr, pw := io.Pipe()
+	var file = &uploadFile{
+		fsys:     f,
+		ctx:      ctx,
+		name:     name,
+		pw:       pw,
+		done:     make(chan struct{}),
+		modified: time.Now(),
+	}
+	go func() {
+		defer close(file.done)
+		file.node, file.err = f.api.PutFilesystemFile(fsp.String(), pr, pixelapi.FilesystemUploadOptions{
+			Overwrite: pixelapi.OverwriteReplace,
+		})
+		// Make the writer fail if the upload stopped before all data was read
+		pr.CloseWithError(file.err)
+	}()
+	return file
+}
+
+// RemoveAll implements webdav.FileSystem
+func (f *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	fsp, err := f.apiPath("remove", name)
+	if err != nil {
+		return err
+	}
+	defer f.fs.Invalidate(fsName(name))
+	if err = f.api.DeleteFilesystemPath(fsp.String(), true); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return pathError("remove", name, err)
+	}
+	return nil
+}
+
+// Rename implements webdav.FileSystem. The webdav handler removes the target
+// before renaming if the client asked to overwrite it
+func (f *FileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	oldPath, err := f.apiPath("rename", oldName)
+	if err != nil {
+		return err
+	}
+	newPath, err := f.apiPath("rename", newName)
+	if err != nil {
+		return err
+	}
+	defer f.fs.Invalidate(fsName(oldName))
+	defer f.fs.Invalidate(fsName(newName))
+	if _, err = f.api.MoveFilesystemPathTo(oldPath.String(), newPath.String()); err != nil {
+		return pathError("rename", oldName, err)
+	}
+	return nil
+}
+
+// Stat implements webdav.FileSystem
+func (f *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	info, err := f.fs.Stat(fsName(name))
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return fileInfo{info}, nil
+}
+
+// fileInfo adds the optional webdav interfaces to the fs.FileInfo of a node
+type fileInfo struct {
+	fs.FileInfo
+}
+
+func (i fileInfo) node() pixelapi.FilesystemNode {
+	node, _ := i.Sys().(pixelapi.FilesystemNode)
+	return node
+}
+
+// ContentType implements webdav.ContentTyper. Without it the webdav package
+// would download the start of every file to guess the type
+func (i fileInfo) ContentType(ctx context.Context) (string, error) {
+	if typ := i.node().FileType; typ != "" {
+		return typ, nil
+	}
+	return "application/octet-stream", nil
+}
+
+// ETag implements webdav.ETager. The ETag is derived from the SHA-256 checksum
+// of the file, so it stays the same when identical content is uploaded again
+func (i fileInfo) ETag(ctx context.Context) (string, error) {
+	if sum := i.node().SHA256Sum; sum != "" {
+		return `"` + sum + `"`, nil
+	}
+	return "", webdav.ErrNotImplemented
+}
+
+// davFile is a file or directory opened for reading
+type davFile struct {
+	fs.File
+}
+
+func (f *davFile) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := f.File.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	return 0, errors.New("is a directory")
+}
+
+func (f *davFile) Write([]byte) (int, error) {
+	return 0, errors.New("file is opened read-only")
+}
+
+func (f *davFile) Stat() (fs.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{info}, nil
+}
+
+// Readdir implements http.File
+func (f *davFile) Readdir(count int) ([]fs.FileInfo, error) {
+	dir, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, errors.New("not a directory")
+	}
+	entries, err := dir.ReadDir(count)
+	var infos = make([]fs.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return infos, err
+		}
+		infos = append(infos, fileInfo{info})
+	}
+	return infos, err
+}
+
+// DeadProps implements webdav.DeadPropsHolder. The node metadata which has no
+// standard DAV property is returned as properties in Namespace
+func (f *davFile) DeadProps() (map[xml.Name]webdav.Property, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	node, _ := info.Sys().(pixelapi.FilesystemNode)
+	return nodeProps(node), nil
+}
+
+// Patch implements webdav.DeadPropsHolder. Properties can't be changed through
+// WebDAV, so all patches are refused
+func (f *davFile) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	var stat = webdav.Propstat{Status: http.StatusForbidden}
+	for _, patch := range patches {
+		for _, prop := range patch.Props {
+			stat.Props = append(stat.Props, webdav.Property{XMLName: prop.XMLName})
+		}
+	}
+	return []webdav.Propstat{stat}, nil
+}
+
+// nodeProps returns the dead properties of a node
+func nodeProps(node pixelapi.FilesystemNode) map[xml.Name]webdav.Property {
+	var props = make(map[xml.Name]webdav.Property)
+	var add = func(space, local, value string) {
+		if value == "" || !validXMLName(local) {
+			return
+		}
+		var buf strings.Builder
+		xml.EscapeText(&buf, []byte(value))
+		var name = xml.Name{Space: space, Local: local}
+		props[name] = webdav.Property{XMLName: name, InnerXML: []byte(buf.String())}
+	}
+
+	if !node.Created.IsZero() {
+		add("DAV:", "creationdate", node.Created.UTC().Format(time.RFC3339))
+	}
+	add(Namespace, "mode", node.ModeStr)
+	add(Namespace, "sha256", node.SHA256Sum)
+	add(Namespace, "created_by", node.CreatedBy)
+	for key, value := range node.Properties {
+		add(Namespace, key, value)
+	}
+	return props
+}
+
+// validXMLName returns true if a property name can be used as an XML element
+// name. Only a conservative subset of the XML name characters is accepted
+func validXMLName(name string) bool {
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		case i > 0 && (c >= '0' && c <= '9' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// uploadFile is a file opened for writing. The written data is streamed to the
+// API
+type uploadFile struct {
+	fsys     *FileSystem
+	ctx      context.Context
+	name     string
+	pw       *io.PipeWriter
+	written  int64
+	modified time.Time
+	failed   error // Reading the data to upload failed, the upload is aborted
+
+	closeOnce sync.Once
+	done      chan struct{}
+	node      pixelapi.FilesystemNode
+	err       error
+}
+
+func (f *uploadFile) Write(b []byte) (int, error) {
+	n, err := f.pw.Write(b)
+	f.written += int64(n)
+	return n, err
+}
+
+// ReadFrom implements io.ReaderFrom. The webdav handler copies the request body
+// with io.Copy, so this is where we learn that the body was cut off, for
+// example because the client disconnected. A write which fails like that is
+// aborted when the file is closed, it must not replace the existing file
+func (f *uploadFile) ReadFrom(r io.Reader) (n int64, err error) {
+	n, err = io.Copy(struct{ io.Writer }{f}, r)
+	if err != nil && f.failed == nil {
+		f.failed = err
+	}
+	return n, err
+}
+
+// Close finishes the upload and returns its error. If the data could not be
+// read completely the upload is aborted instead
+func (f *uploadFile) Close() error {
+	f.closeOnce.Do(func() {
+		if f.failed == nil && f.ctx.Err() != nil {
+			f.failed = f.ctx.Err()
+		}
+		if f.failed != nil {
+			f.pw.CloseWithError(fmt.Errorf("upload aborted: %w", f.failed))
+		} else {
+			f.pw.Close()
+		}
+		<-f.done
+		f.fsys.fs.Invalidate(fsName(f.name))
+	})
+	if f.err != nil {
+		return pathError("write", f.name, f.err)
+	}
+	return nil
+}
+
+func (f *uploadFile) Read([]byte) (int, error) {
+	return 0, errors.New("file is opened write-only")
+}
+
+func (f *uploadFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, errors.New("file is opened write-only")
+}
+
+func (f *uploadFile) Readdir(int) ([]fs.FileInfo, error) {
+	return nil, errors.New("not a directory")
+}
+
+// Stat returns the uploaded node after the file is closed. Before that it
+// describes the data written so far
+func (f *uploadFile) Stat() (fs.FileInfo, error) {
+	select {
+	case <-f.done:
+		if f.err == nil {
+			return fileInfo{f.node.FileInfo()}, nil
+		}
+	default:
+	}
+	return pixelapi.FilesystemNode{
+		Type:     "file",
+		Name:     path.Base(f.name),
+		Modified: f.modified,
+		FileSize: pixelapi.ByteSize(f.written),
+	}.FileInfo(), nil
+}
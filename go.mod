@@ -1,10 +1,18 @@
 module fornaxian.tech/pixeldrain_api_client
 
-go 1.22
+go 1.23.0
 
-require github.com/apache/cassandra-gocql-driver/v2 v2.1.1
+require (
+	github.com/apache/cassandra-gocql-driver/v2 v2.1.1
+	github.com/gorilla/websocket v1.5.3
+	github.com/pkg/sftp v1.13.9
+	golang.org/x/crypto v0.35.0
+	golang.org/x/net v0.34.0
+)
 
 require (
 	github.com/golang/snappy v0.0.4 // indirect
+	github.com/kr/fs v0.1.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
 	gopkg.in/inf.v0 v0.9.1 // indirect
 )
@@ -0,0 +1,133 @@
+package pixelapi
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/http"
+)
+
+// openFileZip opens the central directory of a zip file. Only the end of the
+// file, where the directory is stored, is downloaded
+func (p *PixelAPI) openFileZip(id string) (*zip.Reader, error) {
+	f, err := p.OpenFile(id)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(f, f.Size())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read zip directory of %s: %w", id, err)
+	}
+	return zr, nil
+}
+
+// GetFileZipEntries lists the entries of a zip archive stored on pixeldrain.
+// Only the central directory of the archive is downloaded, using range
+// requests
+func (p *PixelAPI) GetFileZipEntries(id string) ([]zip.FileHeader, error) {
+	zr, err := p.openFileZip(id)
+	if err != nil {
+		return nil, err
+	}
+	var headers = make([]zip.FileHeader, len(zr.File))
+	for i, f := range zr.File {
+		headers[i] = f.FileHeader
+	}
+	return headers, nil
+}
+
+// GetFileZipEntry extracts a single entry from a zip archive stored on
+// pixeldrain. Only the central directory and the compressed data of the entry
+// are downloaded. Stored and deflated entries are supported. The checksum of
+// the entry is verified when the end of the reader is reached. Don't forget to
+// close it!
+func (p *PixelAPI) GetFileZipEntry(id, name string) (io.ReadCloser, error) {
+	zr, err := p.openFileZip(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry *zip.File
+	for _, f := range zr.File {
+		if f.Name == name {
+			entry = f
+			break
+		}
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("zip entry '%s' not found in file %s", name, id)
+	} else if entry.Flags&0x1 != 0 {
+		return nil, fmt.Errorf("zip entry '%s' is encrypted", name)
+	}
+
+	offset, err := entry.DataOffset()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find data of zip entry '%s': %w", name, err)
+	}
+
+	// Download the compressed data in one request instead of letting the zip
+	// package make many small reads
+	var body io.ReadCloser = io.NopCloser(http.NoBody)
+	if entry.CompressedSize64 > 0 {
+		if body, err = p.getRange("file/"+id, offset, int64(entry.CompressedSize64)); err != nil {
+			return nil, err
+		}
+	}
+
+	var data io.ReadCloser
+	switch entry.Method {
+	case zip.Store:
+		data = body
+	case zip.Deflate:
+		data = flate.NewReader(body)
+	default:
+		body.Close()
+		return nil, fmt.Errorf("zip entry '%s' uses unsupported compression method %d", name, entry.Method)
+	}
+
+	return &zipEntryReader{
+		data:  data,
+		body:  body,
+		hash:  crc32.NewIEEE(),
+		crc32: entry.CRC32,
+		left:  int64(entry.UncompressedSize64),
+	}, nil
+}
+
+var errZipChecksum = errors.New("zip entry checksum mismatch")
+
+// zipEntryReader verifies the size and CRC-32 of a zip entry while it is being
+// read
+type zipEntryReader struct {
+	data  io.ReadCloser
+	body  io.Closer
+	hash  hash.Hash32
+	crc32 uint32
+	left  int64
+}
+
+func (z *zipEntryReader) Read(b []byte) (n int, err error) {
+	n, err = z.data.Read(b)
+	z.hash.Write(b[:n])
+	z.left -= int64(n)
+	if z.left < 0 {
+		return n, errors.New("zip entry is larger than its header says")
+	}
+	if err == io.EOF {
+		if z.left > 0 {
+			return n, io.ErrUnexpectedEOF
+		} else if z.crc32 != 0 && z.hash.Sum32() != z.crc32 {
+			return n, errZipChecksum
+		}
+	}
+	return n, err
+}
+
+func (z *zipEntryReader) Close() error {
+	z.data.Close()
+	return z.body.Close()
+}
@@ -0,0 +1,217 @@
+package pixelapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrChecksumMismatch is returned when downloaded data does not match the
+// SHA-256 checksum reported by the API
+var ErrChecksumMismatch = errors.New("sha256 checksum mismatch")
+
+// DownloadCache is an on-disk cache of downloaded files. Files are stored by
+// their SHA-256 checksum, so the same file is only stored once even if it is
+// uploaded multiple times. When the total size of the cache exceeds the limit
+// the least recently used files are removed.
+//
+// Files are written to a temporary file and renamed into place when they are
+// complete, so multiple processes can safely share a cache directory
+type DownloadCache struct {
+	dir     string
+	maxSize ByteSize
+}
+
+// NewDownloadCache creates a download cache in a directory. The directory is
+// created if it does not exist
+func NewDownloadCache(dir string, maxSize ByteSize) (*DownloadCache, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("download cache size must be positive, got %d", maxSize)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create download cache directory: %w", err)
+	}
+	return &DownloadCache{dir: dir, maxSize: maxSize}, nil
+}
+
+// CacheDownloads makes GetFileCached use a download cache
+func (p PixelAPI) CacheDownloads(c *DownloadCache) PixelAPI {
+	p.downloadCache = c
+	return p
+}
+
+// GetFileCached downloads a file through the download cache. If the cache
+// already contains a file with the same SHA-256 checksum it is read from disk
+// and nothing is downloaded. Data read from the cache is verified against the
+// checksum, the reader returns ErrChecksumMismatch at the end of the file if it
+// does not match.
+//
+// A cache hit does not count as a download. If viewToken is not empty a view
+// is registered with PostFileView when the file is read from the cache.
+//
+// Without a download cache, for files which are larger than the cache and for
+// files which don't have a valid checksum yet, like files which were just
+// uploaded, this is the same as GetFile. Don't forget to close the reader!
+func (p *PixelAPI) GetFileCached(id, viewToken string) (io.ReadCloser, error) {
+	var c = p.downloadCache
+	if c == nil {
+		return p.GetFile(id)
+	}
+
+	info, err := p.GetFileInfo(id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = hex.DecodeString(info.HashSHA256); err != nil || len(info.HashSHA256) != sha256.Size*2 {
+		return p.GetFile(id) // Can't be stored without a checksum
+	} else if info.Size > c.maxSize {
+		return p.GetFile(id)
+	}
+
+	var path = filepath.Join(c.dir, strings.ToLower(info.HashSHA256))
+	if file, err := os.Open(path); err == nil {
+		// Update the modification time so the LRU eviction knows this file
+		// was used recently
+		var now = time.Now()
+		_ = os.Chtimes(path, now, now)
+
+		if viewToken != "" {
+			if err = p.PostFileView(id, viewToken); err != nil {
+				file.Close()
+				return nil, fmt.Errorf("failed to register view: %w", err)
+			}
+		}
+		return &hashVerifier{
+			r:        file,
+			c:        file,
+			hash:     sha256.New(),
+			expected: info.HashSHA256,
+			onMismatch: func() {
+				// The cached file is corrupted, remove it so it will be
+				// downloaded again next time
+				_ = os.Remove(path)
+			},
+		}, nil
+	}
+
+	file, err := c.download(p, id, info.HashSHA256, path)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// download downloads a file into the cache and returns it opened for reading.
+// The checksum is verified before the file is moved into place
+func (c *DownloadCache) download(p *PixelAPI, id, sum, path string) (*os.File, error) {
+	resp, err := p.rawRequest("GET", "file/"+id, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	var hasher = sha256.New()
+	if _, err = io.Copy(io.MultiWriter(tmp, hasher), resp.Body); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to download file %s: %w", id, err)
+	} else if err = tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write cache file: %w", err)
+	} else if !strings.EqualFold(hex.EncodeToString(hasher.Sum(nil)), sum) {
+		return nil, fmt.Errorf("download of file %s: %w", id, ErrChecksumMismatch)
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return nil, fmt.Errorf("failed to move file into cache: %w", err)
+	}
+
+	// Open the file before evicting, another process could evict it as soon
+	// as it's in the cache. The download succeeded, so failing to evict old
+	// files is not an error for this call. It's tried again after the next
+	// download
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	_ = c.evict()
+	return file, nil
+}
+
+// evict removes the least recently used files until the cache is within its
+// size limit. Temporary files which were abandoned by crashed processes are
+// also removed
+func (c *DownloadCache) evict() error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return fmt.Errorf("failed to list download cache: %w", err)
+	}
+
+	var files []os.FileInfo
+	var total ByteSize
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue // The file may have been removed by another process
+		}
+		if strings.HasPrefix(entry.Name(), ".tmp-") {
+			if time.Since(info.ModTime()) > time.Hour*24 {
+				_ = os.Remove(filepath.Join(c.dir, entry.Name()))
+			}
+			continue
+		}
+		files = append(files, info)
+		total += ByteSize(info.Size())
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+	for i := 0; total > c.maxSize && i < len(files); i++ {
+		if err = os.Remove(filepath.Join(c.dir, files[i].Name())); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to evict file from download cache: %w", err)
+		}
+		total -= ByteSize(files[i].Size())
+	}
+	return nil
+}
+
+// hashVerifier hashes the data passing through it and returns
+// ErrChecksumMismatch at the end of the stream if the hash does not match the
+// expected hex encoded hash
+type hashVerifier struct {
+	r          io.Reader
+	c          io.Closer
+	hash       hash.Hash
+	expected   string
+	onMismatch func()
+}
+
+func (h *hashVerifier) Read(b []byte) (n int, err error) {
+	n, err = h.r.Read(b)
+	h.hash.Write(b[:n])
+	if err == io.EOF && !strings.EqualFold(hex.EncodeToString(h.hash.Sum(nil)), h.expected) {
+		if h.onMismatch != nil {
+			h.onMismatch()
+		}
+		return n, ErrChecksumMismatch
+	}
+	return n, err
+}
+
+func (h *hashVerifier) Close() error {
+	if h.c == nil {
+		return nil
+	}
+	return h.c.Close()
+}
@@ -1,8 +1,16 @@
 package pixelapi
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -15,10 +23,10 @@ type FileID struct {
 type FileInfo struct {
 	ID                string    `json:"id"`
 	Name              string    `json:"name"`
-	Size              int       `json:"size"`
+	Size              ByteSize  `json:"size"`
 	Views             int       `json:"views"`
-	BandwidthUsed     int       `json:"bandwidth_used"`
-	BandwidthUsedPaid int       `json:"bandwidth_used_paid"`
+	BandwidthUsed     ByteSize  `json:"bandwidth_used"`
+	BandwidthUsedPaid ByteSize  `json:"bandwidth_used_paid"`
 	Downloads         int       `json:"downloads"`
 	DateUpload        time.Time `json:"date_upload"`
 	DateLastView      time.Time `json:"date_last_view"`
@@ -51,10 +59,10 @@ type FileInfo struct {
 
 // FileStats contains realtime statistics for a file
 type FileStats struct {
-	Views         int `json:"views"`
-	Downloads     int `json:"downloads"`
-	Bandwidth     int `json:"bandwidth"`
-	BandwidthPaid int `json:"bandwidth_paid"`
+	Views         int      `json:"views"`
+	Downloads     int      `json:"downloads"`
+	Bandwidth     ByteSize `json:"bandwidth"`
+	BandwidthPaid ByteSize `json:"bandwidth_paid"`
 }
 
 // FileTimeSeries returns historic data for a file
@@ -71,6 +79,26 @@ type TimeSeries struct {
 	Amounts    []int       `json:"amounts"`
 }
 
+// timeSeriesQuery validates the parameters of a time series request and encodes
+// them in query parameters. The API expects the interval in whole minutes
+func timeSeriesQuery(start, end time.Time, interval time.Duration) (url.Values, error) {
+	if start.IsZero() || end.IsZero() {
+		return nil, fmt.Errorf("time series start and end time are required")
+	} else if !end.After(start) {
+		return nil, fmt.Errorf("time series end time %s is not after start time %s", end, start)
+	} else if interval < time.Minute || interval%time.Minute != 0 {
+		return nil, fmt.Errorf("time series interval %s is not a whole number of minutes", interval)
+	} else if interval > end.Sub(start) {
+		return nil, fmt.Errorf("time series interval %s is longer than the range %s", interval, end.Sub(start))
+	}
+
+	return url.Values{
+		"start":    {start.UTC().Format(time.RFC3339)},
+		"end":      {end.UTC().Format(time.RFC3339)},
+		"interval": {strconv.FormatInt(int64(interval/time.Minute), 10)},
+	}, nil
+}
+
 // GetFile makes a file download request and returns a readcloser. Don't forget
 // to close it!
 func (p *PixelAPI) GetFile(id string) (io.ReadCloser, error) {
@@ -82,7 +110,226 @@ func (p *PixelAPI) GetFileInfo(id string) (resp FileInfo, err error) {
 	return resp, p.jsonRequest("GET", "file/"+id+"/info", &resp)
 }
 
+// filesInfoChunkSize is the number of IDs which are requested in a single
+// multi-file info request. This keeps the URL at a reasonable length
+const filesInfoChunkSize = 100
+
+// GetFilesInfo gets the FileInfo of multiple files. The IDs are requested in
+// chunks using the API's comma-separated ID form. If the API does not support
+// this form the files in the chunk are requested one by one instead, with a
+// limited number of requests in flight. Other errors are returned for every ID
+// in the chunk.
+//
+// Every ID ends up in one of the two returned maps. Files which could not be
+// retrieved have an error in the errors map, files which do not exist get an
+// Error with status 404
+func (p *PixelAPI) GetFilesInfo(ids []string) (files map[string]FileInfo, errs map[string]error) {
+	files = make(map[string]FileInfo, len(ids))
+	errs = make(map[string]error)
+
+	// Remove duplicate IDs so every ID is only requested once
+	var unique = make([]string, 0, len(ids))
+	var seen = make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			unique = append(unique, id)
+		}
+	}
+
+	for start := 0; start < len(unique); start += filesInfoChunkSize {
+		var chunk = unique[start:min(start+filesInfoChunkSize, len(unique))]
+
+		// A single ID returns a single FileInfo instead of a list, so there
+		// is no use in batching it
+		var infos []FileInfo
+		var err error
+		if len(chunk) > 1 {
+			infos, err = p.getFilesInfoChunk(chunk)
+			if err != nil && !batchUnsupported(err) {
+				// Don't make things worse by sending a request for every file
+				// when the API is failing
+				for _, id := range chunk {
+					errs[id] = err
+				}
+				continue
+			}
+		}
+		if len(chunk) == 1 || err != nil {
+			// Batching is not available for this chunk, fall back to
+			// requesting the files separately
+			var lock sync.Mutex
+			for id, err := range batch(chunk, func(id string) error {
+				info, err := p.GetFileInfo(id)
+				if err == nil {
+					lock.Lock()
+					files[id] = info
+					lock.Unlock()
+				}
+				return err
+			}) {
+				if err != nil {
+					errs[id] = err
+				}
+			}
+			continue
+		}
+
+		for _, info := range infos {
+			files[info.ID] = info
+		}
+		for _, id := range chunk {
+			if _, ok := files[id]; !ok {
+				errs[id] = Error{
+					Status:     404,
+					StatusCode: "not_found",
+					Message:    "The file " + id + " was not found in the response",
+				}
+			}
+		}
+	}
+	return files, errs
+}
+
+// getFilesInfoChunk requests the info of multiple files in a single request
+func (p *PixelAPI) getFilesInfoChunk(ids []string) ([]FileInfo, error) {
+	var raw json.RawMessage
+	if err := p.jsonRequest("GET", "file/"+strings.Join(ids, ",")+"/info", &raw); err != nil {
+		return nil, err
+	}
+
+	// The files are either returned as a list, or in a files object like the
+	// user files API does
+	var files []FileInfo
+	if raw = bytes.TrimSpace(raw); len(raw) > 0 && raw[0] == '[' {
+		if err := json.Unmarshal(raw, &files); err != nil {
+			return nil, fmt.Errorf("failed to decode file list: %w", err)
+		}
+		return files, nil
+	}
+
+	var resp struct {
+		Files *[]FileInfo `json:"files"`
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode file list: %w", err)
+	} else if resp.Files == nil {
+		return nil, errors.New("failed to decode file list: response has no files")
+	}
+	return *resp.Files, nil
+}
+
+// batchUnsupported returns whether an error means that the API does not
+// support requesting multiple files at once
+func batchUnsupported(err error) bool {
+	var apierr Error
+	return errors.As(err, &apierr) && (apierr.Status == http.StatusBadRequest ||
+		apierr.Status == http.StatusNotFound ||
+		apierr.Status == http.StatusMethodNotAllowed ||
+		apierr.Status == http.StatusNotImplemented)
+}
+
 // PostFileView adds a view to a file
 func (p *PixelAPI) PostFileView(id, viewtoken string) (err error) {
 	return p.form("POST", "file/"+id+"/view", url.Values{"token": {viewtoken}}, nil)
 }
+
+// GetFileTimeSeries returns the view, download and bandwidth statistics of a
+// file between start and end. Each data point in the returned series covers one
+// interval, which must be a whole number of minutes
+func (p *PixelAPI) GetFileTimeSeries(id string, start, end time.Time, interval time.Duration) (resp FileTimeSeries, err error) {
+	query, err := timeSeriesQuery(start, end, interval)
+	if err != nil {
+		return resp, err
+	}
+	return resp, p.jsonRequest("GET", "file/"+id+"/timeseries?"+query.Encode(), &resp)
+}
+
+// DeleteFile deletes a file. Only the owner of a file can delete it
+func (p *PixelAPI) DeleteFile(id string) (err error) {
+	return p.jsonRequest("DELETE", "file/"+id, nil)
+}
+
+// RenameFile changes the name of a file
+func (p *PixelAPI) RenameFile(id, name string) (err error) {
+	if name == "" {
+		return fmt.Errorf("file name cannot be empty")
+	}
+	return p.form("PUT", "file/"+id+"/rename", url.Values{"name": {name}}, nil)
+}
+
+// UpdateFileExpiry sets the custom deletion options of a file. The file will be
+// deleted after deleteAfterDate or after it has been downloaded
+// deleteAfterDownloads times, whichever comes first. A zero time or zero
+// downloads disables that option
+func (p *PixelAPI) UpdateFileExpiry(id string, deleteAfterDate time.Time, deleteAfterDownloads int) (err error) {
+	if deleteAfterDownloads < 0 {
+		return fmt.Errorf("delete after downloads cannot be negative")
+	}
+
+	var date string
+	if !deleteAfterDate.IsZero() {
+		date = deleteAfterDate.UTC().Format(time.RFC3339)
+	}
+	return p.form(
+		"PUT", "file/"+id+"/expiry",
+		url.Values{
+			"delete_after_date":      {date},
+			"delete_after_downloads": {strconv.Itoa(deleteAfterDownloads)},
+		},
+		nil,
+	)
+}
+
+// batchConcurrency is the number of requests the batch functions have in
+// flight at the same time
+const batchConcurrency = 8
+
+// batch runs fn for every ID with a limited number of concurrent calls. The
+// returned map contains an entry for every ID, the value is nil if the call
+// succeeded
+func batch(ids []string, fn func(id string) error) map[string]error {
+	var results = make(map[string]error, len(ids))
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	var sem = make(chan struct{}, batchConcurrency)
+
+	for _, id := range ids {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(id string) {
+			defer func() { <-sem; wg.Done() }()
+			var err = fn(id)
+			lock.Lock()
+			results[id] = err
+			lock.Unlock()
+		}(id)
+	}
+	wg.Wait()
+	return results
+}
+
+// DeleteFiles deletes multiple files. The result contains an entry for every
+// ID, which is nil if the file was deleted
+func (p *PixelAPI) DeleteFiles(ids []string) map[string]error {
+	return batch(ids, p.DeleteFile)
+}
+
+// RenameFiles renames multiple files. The names map is keyed by file ID. The
+// result contains an entry for every ID, which is nil if the file was renamed
+func (p *PixelAPI) RenameFiles(names map[string]string) map[string]error {
+	var ids = make([]string, 0, len(names))
+	for id := range names {
+		ids = append(ids, id)
+	}
+	return batch(ids, func(id string) error { return p.RenameFile(id, names[id]) })
+}
+
+// UpdateFilesExpiry sets the same custom deletion options on multiple files.
+// See UpdateFileExpiry. The result contains an entry for every ID, which is nil
+// if the file was updated
+func (p *PixelAPI) UpdateFilesExpiry(ids []string, deleteAfterDate time.Time, deleteAfterDownloads int) map[string]error {
+	return batch(ids, func(id string) error {
+		return p.UpdateFileExpiry(id, deleteAfterDate, deleteAfterDownloads)
+	})
+}
@@ -0,0 +1,181 @@
+package pixelapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// FileStatsUpdate is a realtime statistics update for a single file
+type FileStatsUpdate struct {
+	FileID string
+	Stats  FileStats
+}
+
+// fileStatsMessage is the envelope of all messages on the stats websocket
+type fileStatsMessage struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+const (
+	fileStatsMinBackoff = time.Second
+	fileStatsMaxBackoff = time.Minute
+)
+
+// WatchFileStats subscribes to the realtime statistics of the given files. The
+// API sends an update every time the statistics of a file change. Every file
+// gets its own websocket connection, which is automatically reconnected when it
+// breaks. When the context is cancelled all connections are closed and the
+// returned channel is closed.
+//
+// The first connection attempt is made before returning, so errors like an
+// invalid API endpoint are returned directly
+func (p *PixelAPI) WatchFileStats(ctx context.Context, ids ...string) (<-chan FileStatsUpdate, error) {
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no file IDs to watch")
+	}
+
+	var conns = make([]*websocket.Conn, len(ids))
+	for i, id := range ids {
+		conn, err := p.dialFileStats(ctx, id)
+		if err != nil {
+			for _, c := range conns[:i] {
+				c.Close()
+			}
+			return nil, fmt.Errorf("failed to watch stats for file %s: %w", id, err)
+		}
+		conns[i] = conn
+	}
+
+	var updates = make(chan FileStatsUpdate)
+	var wg sync.WaitGroup
+	for i := range ids {
+		wg.Add(1)
+		go func(id string, conn *websocket.Conn) {
+			defer wg.Done()
+			p.watchFileStats(ctx, id, conn, updates)
+		}(ids[i], conns[i])
+	}
+	go func() {
+		wg.Wait()
+		close(updates)
+	}()
+
+	return updates, nil
+}
+
+// watchFileStats reads updates from the connection until the context is
+// cancelled. When the connection breaks it reconnects with exponential backoff
+func (p *PixelAPI) watchFileStats(ctx context.Context, id string, conn *websocket.Conn, updates chan<- FileStatsUpdate) {
+	var backoff = fileStatsMinBackoff
+	for {
+		if conn != nil {
+			if p.readFileStats(ctx, id, conn, updates) {
+				// At least one message was received, so the connection was
+				// healthy. Start with a short backoff again
+				backoff = fileStatsMinBackoff
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, fileStatsMaxBackoff)
+
+		var err error
+		if conn, err = p.dialFileStats(ctx, id); err != nil {
+			conn = nil
+		}
+	}
+}
+
+// readFileStats forwards stats updates until the connection breaks or the
+// context is cancelled. The connection is always closed when it returns. The
+// return value indicates whether any messages were received
+func (p *PixelAPI) readFileStats(ctx context.Context, id string, conn *websocket.Conn, updates chan<- FileStatsUpdate) (received bool) {
+	// ReadMessage does not support contexts, so we close the connection from
+	// another goroutine to unblock it
+	var done = make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+				time.Now().Add(time.Second),
+			)
+		case <-done:
+		}
+		conn.Close()
+	}()
+
+	for {
+		var msg fileStatsMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return received
+		}
+		received = true
+
+		var update = FileStatsUpdate{FileID: id}
+		if msg.Type != "file_stats" || json.Unmarshal(msg.Data, &update.Stats) != nil {
+			continue
+		}
+
+		select {
+		case updates <- update:
+		case <-ctx.Done():
+			return received
+		}
+	}
+}
+
+// dialFileStats opens a stats websocket and subscribes to the file
+func (p *PixelAPI) dialFileStats(ctx context.Context, id string) (*websocket.Conn, error) {
+	var endpoint = p.apiEndpoint + "/file_stats"
+	if strings.HasPrefix(endpoint, "https://") {
+		endpoint = "wss://" + strings.TrimPrefix(endpoint, "https://")
+	} else if strings.HasPrefix(endpoint, "http://") {
+		endpoint = "ws://" + strings.TrimPrefix(endpoint, "http://")
+	}
+
+	// Borrow the headers and dialer from the HTTP client, so authentication
+	// and unix sockets work the same as for normal requests
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	p.setHeaders(req)
+
+	var dialer = *websocket.DefaultDialer
+	if t, ok := p.client.Transport.(*http.Transport); ok {
+		dialer.NetDialContext = t.DialContext
+	}
+
+	conn, resp, err := dialer.DialContext(ctx, endpoint, req.Header)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("websocket handshake failed with status %s: %w", resp.Status, err)
+		}
+		return nil, err
+	}
+
+	err = conn.WriteJSON(map[string]any{
+		"type": "file_stats",
+		"data": map[string]string{"file_id": id},
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to subscribe to file stats: %w", err)
+	}
+	return conn, nil
+}
@@ -1,6 +1,7 @@
 package pixelapi
 
 import (
+	"errors"
 	"net/url"
 	"time"
 )
@@ -30,9 +31,9 @@ type FilesystemNode struct {
 	AbuseReportTime *time.Time `json:"abuse_report_time,omitempty"`
 
 	// File params
-	FileSize  int    `json:"file_size"`
-	FileType  string `json:"file_type"`
-	SHA256Sum string `json:"sha256_sum"`
+	FileSize  ByteSize `json:"file_size"`
+	FileType  string   `json:"file_type"`
+	SHA256Sum string   `json:"sha256_sum"`
 
 	// Meta params
 	ID                  string                 `json:"id,omitempty"`
@@ -63,13 +64,190 @@ type FilesystemTimeSeries struct {
 	TransferPaid TimeSeries `json:"transfer_paid"`
 }
 
+// Error codes returned by the filesystem API
+const (
+	ErrCodeAlreadyExists = "node_already_exists"
+	ErrCodeNotEmpty      = "directory_not_empty"
+	ErrCodeNotFound      = "path_not_found"
+)
+
+// ErrIsAlreadyExists returns true if the error means that the target of a
+// filesystem operation already exists
+func ErrIsAlreadyExists(err error) bool {
+	var apierr Error
+	return errors.As(err, &apierr) && apierr.StatusCode == ErrCodeAlreadyExists
+}
+
+// ErrIsNotEmpty returns true if the error means that a directory could not be
+// deleted because it's not empty
+func ErrIsNotEmpty(err error) bool {
+	var apierr Error
+	return errors.As(err, &apierr) && apierr.StatusCode == ErrCodeNotEmpty
+}
+
+// ErrIsPathNotFound returns true if the error means that a filesystem path does
+// not exist
+func ErrIsPathNotFound(err error) bool {
+	var apierr Error
+	return errors.As(err, &apierr) && apierr.StatusCode == ErrCodeNotFound
+}
+
+// Node returns the node which was requested, without its parents and children
+func (f FilesystemPath) Node() FilesystemNode {
+	if f.BaseIndex < 0 || f.BaseIndex >= len(f.Path) {
+		return FilesystemNode{}
+	}
+	return f.Path[f.BaseIndex]
+}
+
 // GetFilesystemBuckets returns a list of filesystems for the user. You need to
 // be authenticated
 func (p *PixelAPI) GetFilesystems() (resp []FilesystemNode, err error) {
 	return resp, p.jsonRequest("GET", "filesystem", &resp)
 }
 
-// GetFilesystemPath opens a filesystem path
+// GetFilesystemPath opens a filesystem path. The path is parsed with
+// ParseFSPath
 func (p *PixelAPI) GetFilesystemPath(path string) (resp FilesystemPath, err error) {
-	return resp, p.jsonRequest("GET", "filesystem/"+url.PathEscape(path)+"?stat", &resp)
+	apiPath, err := fsURL(path)
+	if err != nil {
+		return resp, err
+	}
+	return resp, p.jsonRequest("GET", apiPath+"?stat", &resp)
+}
+
+// GetFilesystemTimeSeries returns the download and transfer statistics of a
+// filesystem node between start and end. Each data point in the returned series
+// covers one interval, which must be a whole number of minutes
+func (p *PixelAPI) GetFilesystemTimeSeries(path string, start, end time.Time, interval time.Duration) (resp FilesystemTimeSeries, err error) {
+	apiPath, err := fsURL(path)
+	if err != nil {
+		return resp, err
+	}
+	query, err := timeSeriesQuery(start, end, interval)
+	if err != nil {
+		return resp, err
+	}
+	return resp, p.jsonRequest("GET", apiPath+"?timeseries&"+query.Encode(), &resp)
+}
+
+// StatFilesystemPath returns the node at a path
+func (p *PixelAPI) StatFilesystemPath(path string) (node FilesystemNode, err error) {
+	fsp, err := p.GetFilesystemPath(path)
+	if err != nil {
+		return node, err
+	}
+	return fsp.Node(), nil
+}
+
+// filesystemAction performs a POST action on a filesystem node and returns the
+// node the action resulted in
+func (p *PixelAPI) filesystemAction(path, action string, vals url.Values) (node FilesystemNode, err error) {
+	apiPath, err := fsURL(path)
+	if err != nil {
+		return node, err
+	}
+	if vals == nil {
+		vals = url.Values{}
+	}
+	vals.Set("action", action)
+	return node, p.form("POST", apiPath, vals, &node)
+}
+
+// MkdirAllFilesystem creates a directory and any missing parent directories,
+// like os.MkdirAll. If the directory already exists it is returned unchanged
+func (p *PixelAPI) MkdirAllFilesystem(path string) (node FilesystemNode, err error) {
+	return p.filesystemAction(path, "mkdirall", nil)
+}
+
+// DeleteFilesystemPath deletes a file or directory. Directories which are not
+// empty can only be deleted with recursive, otherwise an ErrCodeNotEmpty error
+// is returned
+func (p *PixelAPI) DeleteFilesystemPath(path string, recursive bool) (err error) {
+	fsp, err := ParseFSPath(path)
+	if err != nil {
+		return err
+	} else if len(fsp.Segments()) < 2 {
+		return errors.New("cannot delete a bucket or the root")
+	}
+
+	var query = ""
+	if recursive {
+		query = "?recursive"
+	}
+	return p.jsonRequest("DELETE", "filesystem/"+fsp.Escaped()+query, nil)
+}
+
+// RenameFilesystemPath changes the name of a file or directory without moving
+// it to another directory. An ErrCodeAlreadyExists error is returned if a node
+// with the new name already exists
+func (p *PixelAPI) RenameFilesystemPath(path, name string) (node FilesystemNode, err error) {
+	fsp, err := ParseFSPath(path)
+	if err != nil {
+		return node, err
+	}
+	target, err := fsp.Parent().Join(name)
+	if err != nil {
+		return node, err
+	}
+	return p.filesystemAction(path, "rename", url.Values{"target": {target.String()}})
+}
+
+// MoveFilesystemPath moves a file or directory into another directory, keeping
+// its name. An ErrCodeAlreadyExists error is returned if the target directory
+// already contains a node with the same name
+func (p *PixelAPI) MoveFilesystemPath(path, dir string) (node FilesystemNode, err error) {
+	fsp, err := ParseFSPath(path)
+	if err != nil {
+		return node, err
+	}
+	dirPath, err := ParseFSPath(dir)
+	if err != nil {
+		return node, err
+	}
+	target, err := dirPath.Join(fsp.Base())
+	if err != nil {
+		return node, err
+	}
+	return p.MoveFilesystemPathTo(path, target.String())
+}
+
+// MoveFilesystemPathTo moves a file or directory to a target path. The target
+// can be in another directory and have another name. An ErrCodeAlreadyExists
+// error is returned if the target already exists
+func (p *PixelAPI) MoveFilesystemPathTo(path, target string) (node FilesystemNode, err error) {
+	fsp, err := ParseFSPath(path)
+	if err != nil {
+		return node, err
+	}
+	targetPath, err := ParseFSPath(target)
+	if err != nil {
+		return node, err
+	}
+	if targetPath.String() == fsp.String() {
+		return node, errors.New("source and target are the same")
+	} else if targetPath.HasPrefix(fsp) {
+		return node, errors.New("cannot move a directory into itself")
+	}
+	return p.filesystemAction(path, "rename", url.Values{"target": {targetPath.String()}})
+}
+
+// CopyFilesystemPath copies a file or directory to a target path. Directories
+// are copied with all their contents. An ErrCodeAlreadyExists error is returned
+// if the target already exists
+func (p *PixelAPI) CopyFilesystemPath(path, target string) (node FilesystemNode, err error) {
+	fsp, err := ParseFSPath(path)
+	if err != nil {
+		return node, err
+	}
+	targetPath, err := ParseFSPath(target)
+	if err != nil {
+		return node, err
+	}
+	if targetPath.String() == fsp.String() {
+		return node, errors.New("source and target are the same")
+	} else if targetPath.HasPrefix(fsp) {
+		return node, errors.New("cannot copy a directory into itself")
+	}
+	return p.filesystemAction(path, "copy", url.Values{"target": {targetPath.String()}})
 }
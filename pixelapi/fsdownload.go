@@ -0,0 +1,131 @@
+package pixelapi
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotModified is returned by OpenFilesystemFile when a conditional request
+// found that the file has not changed
+var ErrNotModified = errors.New("file not modified")
+
+// FilesystemReadOptions changes the behaviour of OpenFilesystemFile
+type FilesystemReadOptions struct {
+	// Offset is the position in the file to start reading at
+	Offset int64
+
+	// Length is the number of bytes to read. Zero means until the end of the
+	// file
+	Length int64
+
+	// IfModifiedSince makes the request return ErrNotModified if the file was
+	// not modified after this time
+	IfModifiedSince time.Time
+
+	// IfNoneMatch makes the request return ErrNotModified if the ETag of the
+	// file is the same as this ETag
+	IfNoneMatch string
+}
+
+// FilesystemFile is an opened file from the filesystem API. Read the contents
+// from it and don't forget to close it!
+type FilesystemFile struct {
+	io.ReadCloser
+
+	// Size is the size of the whole file, not only the requested range
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+	ETag        string
+
+	// Offset and Length describe the part of the file which can be read
+	Offset int64
+	Length int64
+}
+
+// OpenFilesystemFile opens a file on the filesystem API for reading. With the
+// options a part of the file can be requested, or the file can be requested
+// only if it has changed. If a conditional request finds that the file did not
+// change ErrNotModified is returned
+func (p *PixelAPI) OpenFilesystemFile(path string, opts FilesystemReadOptions) (*FilesystemFile, error) {
+	apiPath, err := fsURL(path)
+	if err != nil {
+		return nil, err
+	} else if opts.Offset < 0 || opts.Length < 0 {
+		return nil, fmt.Errorf("negative offset %d or length %d", opts.Offset, opts.Length)
+	}
+
+	var header = http.Header{}
+	if opts.Offset > 0 || opts.Length > 0 {
+		var rng = "bytes=" + strconv.FormatInt(opts.Offset, 10) + "-"
+		if opts.Length > 0 {
+			rng += strconv.FormatInt(opts.Offset+opts.Length-1, 10)
+		}
+		header.Set("Range", rng)
+	}
+	if !opts.IfModifiedSince.IsZero() {
+		header.Set("If-Modified-Since", opts.IfModifiedSince.UTC().Format(http.TimeFormat))
+	}
+	if opts.IfNoneMatch != "" {
+		header.Set("If-None-Match", opts.IfNoneMatch)
+	}
+
+	resp, err := p.rawRequest("GET", apiPath, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		return nil, ErrNotModified
+	} else if header.Get("Range") != "" && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("range request for '%s' returned status %s instead of partial content", path, resp.Status)
+	}
+
+	var file = &FilesystemFile{
+		ReadCloser:  resp.Body,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag:        resp.Header.Get("ETag"),
+		Length:      resp.ContentLength,
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		file.ModTime = t
+	}
+
+	// Content-Range looks like "bytes 100-199/1000"
+	if cr := resp.Header.Get("Content-Range"); resp.StatusCode == http.StatusPartialContent && cr != "" {
+		var rng, total, _ = strings.Cut(strings.TrimPrefix(cr, "bytes "), "/")
+		var start, _, _ = strings.Cut(rng, "-")
+		if file.Offset, err = strconv.ParseInt(start, 10, 64); err != nil {
+			resp.Body.Close()
+			return nil, fmt.Errorf("invalid Content-Range '%s': %w", cr, err)
+		}
+		if file.Size, err = strconv.ParseInt(total, 10, 64); err != nil {
+			file.Size = -1 // The total size is unknown ("*")
+		}
+	}
+	return file, nil
+}
+
+// OpenFilesystemFileAt opens a file on the filesystem API for random access.
+// See RemoteFile
+func (p *PixelAPI) OpenFilesystemFileAt(path string) (*RemoteFile, error) {
+	apiPath, err := fsURL(path)
+	if err != nil {
+		return nil, err
+	}
+	node, err := p.StatFilesystemPath(path)
+	if err != nil {
+		return nil, err
+	} else if node.IsDir() {
+		return nil, fmt.Errorf("path '%s' is a directory", path)
+	}
+	return p.openRemoteFile(apiPath, int64(node.FileSize)), nil
+}
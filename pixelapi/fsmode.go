@@ -0,0 +1,121 @@
+package pixelapi
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Unix permission bits which have a different position in fs.FileMode
+const (
+	unixSetuid = 04000
+	unixSetgid = 02000
+	unixSticky = 01000
+)
+
+// IsDir returns true if the node is a directory
+func (n FilesystemNode) IsDir() bool { return n.Type == "dir" }
+
+// Sys returns the node itself, like fs.FileInfo.Sys does for the underlying
+// data source
+func (n FilesystemNode) Sys() any { return n }
+
+// Mode returns the mode of the node as an fs.FileMode. The permission bits are
+// parsed from ModeOctal, which uses the Unix layout where the setuid, setgid and
+// sticky bits are 04000, 02000 and 01000. If ModeOctal is empty or invalid
+// ModeStr is used instead, and if that fails as well directories get 0755 and
+// files get 0644. Directories always have fs.ModeDir set
+func (n FilesystemNode) Mode() fs.FileMode {
+	var mode fs.FileMode
+	if octal, err := strconv.ParseUint(n.ModeOctal, 8, 32); err == nil {
+		mode = unixToFileMode(uint32(octal))
+	} else if parsed, err := ParseFileMode(n.ModeStr); err == nil {
+		mode = parsed
+	} else if n.IsDir() {
+		mode = 0755
+	} else {
+		mode = 0644
+	}
+
+	if n.IsDir() {
+		return mode | fs.ModeDir
+	}
+	return mode &^ fs.ModeType
+}
+
+// unixToFileMode converts Unix permission bits to an fs.FileMode
+func unixToFileMode(octal uint32) fs.FileMode {
+	var mode = fs.FileMode(octal) & fs.ModePerm
+	if octal&unixSetuid != 0 {
+		mode |= fs.ModeSetuid
+	}
+	if octal&unixSetgid != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if octal&unixSticky != 0 {
+		mode |= fs.ModeSticky
+	}
+	return mode
+}
+
+// FormatModeOctal formats the permission bits of a mode in the Unix octal
+// layout used by ModeOctal, like "0755" or "4755". The file type bits are not
+// included
+func FormatModeOctal(mode fs.FileMode) string {
+	var octal = uint32(mode & fs.ModePerm)
+	if mode&fs.ModeSetuid != 0 {
+		octal |= unixSetuid
+	}
+	if mode&fs.ModeSetgid != 0 {
+		octal |= unixSetgid
+	}
+	if mode&fs.ModeSticky != 0 {
+		octal |= unixSticky
+	}
+	return fmt.Sprintf("%04o", octal)
+}
+
+// fileModeChars are the type characters fs.FileMode.String writes before the
+// permissions, in the same order
+const fileModeChars = "dalTLDpSugct?"
+
+// ParseFileMode parses a mode string in the format of fs.FileMode.String, which
+// is also the format of ModeStr. Examples are "-rw-r--r--" and "drwxr-xr-x".
+// For every mode m, ParseFileMode(m.String()) returns m
+func ParseFileMode(s string) (mode fs.FileMode, err error) {
+	if len(s) < 10 {
+		return 0, fmt.Errorf("invalid mode string '%s': too short", s)
+	}
+	var typ, perm = s[:len(s)-9], s[len(s)-9:]
+
+	if typ != "-" {
+		var last = -1
+		for _, c := range typ {
+			var i = strings.IndexRune(fileModeChars, c)
+			if i <= last {
+				return 0, fmt.Errorf("invalid mode string '%s': unexpected type character '%c'", s, c)
+			}
+			last = i
+			mode |= 1 << uint(32-1-i)
+		}
+	}
+
+	for i := 0; i < len(perm); i++ {
+		switch c := perm[i]; c {
+		case "rwxrwxrwx"[i]:
+			mode |= 1 << uint(8-i)
+		case '-':
+		default:
+			return 0, fmt.Errorf("invalid mode string '%s': unexpected permission character '%c'", s, c)
+		}
+	}
+	return mode, nil
+}
+
+// ChmodFilesystemPath changes the permission bits of a file or directory. Only
+// the permission, setuid, setgid and sticky bits of mode are used
+func (p *PixelAPI) ChmodFilesystemPath(path string, mode fs.FileMode) (node FilesystemNode, err error) {
+	return p.filesystemAction(path, "update", url.Values{"mode": {FormatModeOctal(mode)}})
+}
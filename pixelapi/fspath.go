@@ -0,0 +1,136 @@
+package pixelapi
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// FSPath is a normalized and validated filesystem path. The first segment of
+// the path is the bucket, the following segments are directories and files in
+// the bucket. Paths never contain empty, "." or ".." segments. The zero value is
+// the root which contains the buckets
+type FSPath struct {
+	segments []string
+}
+
+// ParseFSPath parses a filesystem path like "/bucket/dir/file.txt". The leading
+// and trailing slash are optional. Empty segments, like in "a//b", and "." and
+// ".." segments are rejected. All other characters are allowed in segments,
+// including '#', '?', '%' and unicode, they are escaped when the path is used in
+// a request
+func ParseFSPath(path string) (FSPath, error) {
+	path = strings.TrimPrefix(path, "/")
+	path = strings.TrimSuffix(path, "/")
+	if path == "" {
+		return FSPath{}, nil
+	}
+
+	var segments = strings.Split(path, "/")
+	for _, s := range segments {
+		if err := validateFSName(s); err != nil {
+			return FSPath{}, fmt.Errorf("invalid path '%s': %w", path, err)
+		}
+	}
+	return FSPath{segments: segments}, nil
+}
+
+// validateFSName checks if a single path segment is valid
+func validateFSName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("empty path segment")
+	case name == "." || name == "..":
+		return fmt.Errorf("path segment '%s' is not allowed", name)
+	case strings.ContainsAny(name, "/\x00"):
+		return fmt.Errorf("path segment '%s' contains a slash or null byte", name)
+	}
+	return nil
+}
+
+// String returns the path with a leading slash, like "/bucket/dir/file.txt".
+// The root is "/"
+func (p FSPath) String() string {
+	return "/" + strings.Join(p.segments, "/")
+}
+
+// Escaped returns the path without leading slash, with every segment escaped
+// for use in a URL. Slashes between segments are not escaped
+func (p FSPath) Escaped() string {
+	var escaped = make([]string, len(p.segments))
+	for i, s := range p.segments {
+		escaped[i] = url.PathEscape(s)
+	}
+	return strings.Join(escaped, "/")
+}
+
+// IsRoot returns true if this is the root path, which contains the buckets
+func (p FSPath) IsRoot() bool { return len(p.segments) == 0 }
+
+// Bucket returns the first segment of the path, which is the bucket
+func (p FSPath) Bucket() string {
+	if p.IsRoot() {
+		return ""
+	}
+	return p.segments[0]
+}
+
+// Base returns the last segment of the path, which is the name of the node
+func (p FSPath) Base() string {
+	if p.IsRoot() {
+		return ""
+	}
+	return p.segments[len(p.segments)-1]
+}
+
+// Parent returns the directory containing the path. The parent of the root is
+// the root
+func (p FSPath) Parent() FSPath {
+	if p.IsRoot() {
+		return p
+	}
+	return FSPath{segments: p.segments[:len(p.segments)-1]}
+}
+
+// Segments returns a copy of the segments of the path
+func (p FSPath) Segments() []string {
+	return append([]string(nil), p.segments...)
+}
+
+// Join returns the path with names appended to it. Every name is a single path
+// segment, so names cannot contain slashes
+func (p FSPath) Join(names ...string) (FSPath, error) {
+	var segments = make([]string, len(p.segments), len(p.segments)+len(names))
+	copy(segments, p.segments)
+	for _, name := range names {
+		if err := validateFSName(name); err != nil {
+			return p, fmt.Errorf("cannot join '%s' to '%s': %w", name, p, err)
+		}
+		segments = append(segments, name)
+	}
+	return FSPath{segments: segments}, nil
+}
+
+// HasPrefix returns true if the path is equal to prefix or is inside it
+func (p FSPath) HasPrefix(prefix FSPath) bool {
+	if len(prefix.segments) > len(p.segments) {
+		return false
+	}
+	for i := range prefix.segments {
+		if p.segments[i] != prefix.segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// fsURL parses a filesystem path and returns the API path for it
+func fsURL(path string) (string, error) {
+	fsp, err := ParseFSPath(path)
+	if err != nil {
+		return "", err
+	} else if fsp.IsRoot() {
+		return "", fmt.Errorf("path '%s' does not contain a bucket", path)
+	}
+	return "filesystem/" + fsp.Escaped(), nil
+}
@@ -0,0 +1,186 @@
+package pixelapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OverwritePolicy decides what PutFilesystemFile does when the target path
+// already exists.
+//
+// The API always replaces existing files on upload, so OverwriteFail and
+// OverwriteRename are checked by listing the target directory before the
+// upload starts. This check is best-effort: a file which is created at the
+// same path by another client between the check and the upload is replaced
+type OverwritePolicy int
+
+// Overwrite policies for PutFilesystemFile
+const (
+	// OverwriteFail returns an ErrCodeAlreadyExists error
+	OverwriteFail OverwritePolicy = iota
+	// OverwriteReplace replaces the existing file
+	OverwriteReplace
+	// OverwriteRename uploads the file under a new name by adding a number
+	// to the name, like "photo (2).jpg"
+	OverwriteRename
+)
+
+// FilesystemUploadOptions changes the behaviour of PutFilesystemFile
+type FilesystemUploadOptions struct {
+	// MakeParents creates the parent directories of the file if they don't
+	// exist yet
+	MakeParents bool
+
+	// Overwrite decides what happens if the file already exists
+	Overwrite OverwritePolicy
+
+	// Modified sets the modification time of the file. If it's zero the time
+	// of the upload is used
+	Modified time.Time
+
+	// Properties are set on the file after uploading
+	Properties map[string]string
+
+	// Deduplicate makes the uploader look for a file with the same SHA-256
+	// checksum in the target directory first. If it finds one that file is
+	// returned instead of uploading
+	Deduplicate bool
+}
+
+// PutFilesystemFile uploads a file to a filesystem path. The data is hashed
+// while uploading, and the checksum is compared to the SHA256Sum of the node
+// the API returns. ErrChecksumMismatch is returned if they don't match. If the
+// server has not hashed the file yet the checksum can't be verified, and the
+// node is returned without a SHA256Sum.
+//
+// If deduplication is enabled and a duplicate was found, the existing node is
+// returned. Its path can differ from the requested path
+func (p *PixelAPI) PutFilesystemFile(filePath string, r io.Reader, opts FilesystemUploadOptions) (node FilesystemNode, err error) {
+	fsp, err := ParseFSPath(filePath)
+	if err != nil {
+		return node, err
+	} else if len(fsp.Segments()) < 2 {
+		return node, fmt.Errorf("path '%s' is not inside a bucket", filePath)
+	}
+
+	if opts.MakeParents && len(fsp.Parent().Segments()) > 1 {
+		if _, err = p.MkdirAllFilesystem(fsp.Parent().String()); err != nil {
+			return node, fmt.Errorf("failed to create parent directories: %w", err)
+		}
+	}
+
+	if opts.Deduplicate {
+		body, sum, cleanup, err := hashUpload(r)
+		if err != nil {
+			return node, err
+		}
+		defer cleanup()
+
+		dup, ok, err := p.FindFilesystemDuplicate(fsp.Parent().String(), sum)
+		if err != nil && !ErrIsNotFound(err) {
+			return node, fmt.Errorf("failed to check for duplicate files: %w", err)
+		} else if ok {
+			return dup, nil
+		}
+		r = body
+	}
+
+	if fsp, err = p.uploadTarget(fsp, opts.Overwrite); err != nil {
+		return node, err
+	}
+
+	var hasher = sha256.New()
+	err = p.bodyRequest(
+		"PUT", "filesystem/"+fsp.Escaped(), "application/octet-stream",
+		io.TeeReader(r, hasher), &node,
+	)
+	if err != nil {
+		return node, err
+	}
+
+	if !opts.Modified.IsZero() || len(opts.Properties) > 0 {
+		var vals = url.Values{}
+		if !opts.Modified.IsZero() {
+			vals.Set("modified", opts.Modified.UTC().Format(time.RFC3339Nano))
+		}
+		if len(opts.Properties) > 0 {
+			props, err := json.Marshal(opts.Properties)
+			if err != nil {
+				return node, fmt.Errorf("failed to encode properties: %w", err)
+			}
+			vals.Set("properties", string(props))
+		}
+		if node, err = p.filesystemAction(fsp.String(), "update", vals); err != nil {
+			return node, fmt.Errorf("failed to update file metadata: %w", err)
+		}
+	}
+
+	if node.SHA256Sum == "" {
+		if node, err = p.StatFilesystemPath(fsp.String()); err != nil {
+			return node, err
+		} else if node.SHA256Sum == "" {
+			return node, nil // Not hashed yet, there is nothing to compare with
+		}
+	}
+	if !strings.EqualFold(node.SHA256Sum, hex.EncodeToString(hasher.Sum(nil))) {
+		return node, fmt.Errorf("upload of '%s': %w", fsp, ErrChecksumMismatch)
+	}
+	return node, nil
+}
+
+// uploadTarget applies the overwrite policy and returns the path the file
+// should be uploaded to
+func (p *PixelAPI) uploadTarget(fsp FSPath, policy OverwritePolicy) (FSPath, error) {
+	dir, err := p.GetFilesystemPath(fsp.Parent().String())
+	if ErrIsNotFound(err) {
+		return fsp, nil // The parent does not exist, so the file doesn't either
+	} else if err != nil {
+		return fsp, err
+	}
+
+	var taken = make(map[string]FilesystemNode, len(dir.Children))
+	for _, child := range dir.Children {
+		taken[child.Name] = child
+	}
+
+	existing, ok := taken[fsp.Base()]
+	if !ok {
+		return fsp, nil
+	}
+
+	switch policy {
+	case OverwriteReplace:
+		if existing.IsDir() {
+			return fsp, Error{
+				Status:     http.StatusConflict,
+				StatusCode: ErrCodeAlreadyExists,
+				Message:    "Cannot replace directory " + fsp.String() + " with a file",
+			}
+		}
+		return fsp, nil
+	case OverwriteRename:
+		var ext = path.Ext(fsp.Base())
+		var base = strings.TrimSuffix(fsp.Base(), ext)
+		for n := 2; ; n++ {
+			var name = base + " (" + strconv.Itoa(n) + ")" + ext
+			if _, ok := taken[name]; !ok {
+				return fsp.Parent().Join(name)
+			}
+		}
+	default:
+		return fsp, Error{
+			Status:     http.StatusConflict,
+			StatusCode: ErrCodeAlreadyExists,
+			Message:    "The path " + fsp.String() + " already exists",
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package pixelapi
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// FilesystemWalkFunc is called by WalkFilesystem for every node it visits. p is
+// the full filesystem path of the node.
+//
+// A directory is passed to the function before it's listed. If listing the
+// directory fails the function is called a second time for the directory with
+// the error. Returning nil or fs.SkipDir from that call continues the walk with
+// the next directory, returning another error stops the walk.
+//
+// Returning fs.SkipDir for a directory skips everything in it, returning it for
+// a file skips the remaining files in the same directory. fs.SkipAll stops the
+// walk without an error. Any other error stops the walk and is returned by
+// WalkFilesystem
+type FilesystemWalkFunc func(p string, node FilesystemNode, err error) error
+
+// FilesystemWalkOptions changes the behaviour of WalkFilesystem
+type FilesystemWalkOptions struct {
+	// Concurrency is the number of directories which are listed at the same
+	// time. Zero means 8
+	Concurrency int
+
+	// MaxDepth is the number of levels below the root which are visited. One
+	// only visits the direct children of the root. Zero means no limit
+	MaxDepth int
+
+	// Include patterns select the files which are visited. Directories are
+	// always visited so files in them can match. Patterns use the syntax of
+	// path.Match. A pattern which contains a slash is matched against the path
+	// relative to the root, other patterns are matched against the name. When
+	// there are no patterns all files are visited
+	Include []string
+
+	// Exclude patterns select files and directories which are not visited.
+	// Nothing below an excluded directory is listed. The syntax is the same as
+	// for Include
+	Exclude []string
+
+	// Sorted makes the walk visit nodes in lexical order, like fs.WalkDir.
+	// Subdirectories are still listed concurrently ahead of time. Without it
+	// nodes are visited in the order their directories finish listing, which
+	// is faster when directories are large
+	Sorted bool
+}
+
+// WalkFilesystem walks the tree at root and calls fn for every node in it,
+// starting with the root itself. The root "/" walks all buckets of the user.
+// Directories are listed concurrently, but fn is never called concurrently.
+// Errors from listing directories are passed to fn, so one unreadable
+// directory does not stop the walk
+func (p *PixelAPI) WalkFilesystem(root string, fn FilesystemWalkFunc, opts FilesystemWalkOptions) error {
+	fsp, err := ParseFSPath(root)
+	if err != nil {
+		return err
+	}
+	for _, pattern := range append(opts.Include, opts.Exclude...) {
+		if _, err = path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = batchConcurrency
+	}
+
+	var w = &walker{
+		api:  p,
+		fn:   fn,
+		opts: opts,
+		sem:  make(chan struct{}, opts.Concurrency),
+	}
+	var listing = w.prefetch(fsp)
+	<-listing.done
+	if listing.err != nil {
+		err = fn(fsp.String(), FilesystemNode{}, listing.err)
+	} else if err = fn(fsp.String(), listing.resp.Node(), nil); err == nil {
+		if opts.Sorted {
+			err = w.walkSorted(fsp, "", 0, listing)
+		} else {
+			w.lock.Lock()
+			w.visitChildren(fsp, "", 0, listing.resp.Children)
+			w.lock.Unlock()
+			w.wg.Wait()
+			err = w.err
+		}
+	}
+
+	w.stopped.Store(true)
+	w.wg.Wait()
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walker holds the state of a single WalkFilesystem call
+type walker struct {
+	api  *PixelAPI
+	fn   FilesystemWalkFunc
+	opts FilesystemWalkOptions
+	sem  chan struct{} // Limits the number of concurrent listings
+	wg   sync.WaitGroup
+
+	// lock serializes calls to fn when the walk is not sorted. err is the
+	// error which stopped the walk
+	lock    sync.Mutex
+	err     error
+	stopped atomic.Bool
+}
+
+// walkListing is a directory listing which is requested in the background
+type walkListing struct {
+	resp     FilesystemPath
+	err      error
+	done     chan struct{}
+	canceled atomic.Bool
+}
+
+// prefetch starts listing a directory. Nothing is requested if the listing is
+// canceled or the walk stops before it's its turn
+func (w *walker) prefetch(dir FSPath) *walkListing {
+	var l = &walkListing{done: make(chan struct{})}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer close(l.done)
+		w.sem <- struct{}{}
+		defer func() { <-w.sem }()
+		if l.canceled.Load() || w.stopped.Load() {
+			l.err = fs.SkipAll
+			return
+		}
+		l.resp, l.err = w.list(dir)
+	}()
+	return l
+}
+
+// list returns the children of a directory. The root lists the buckets
+func (w *walker) list(dir FSPath) (resp FilesystemPath, err error) {
+	if !dir.IsRoot() {
+		return w.api.GetFilesystemPath(dir.String())
+	}
+	buckets, err := w.api.GetFilesystems()
+	if err != nil {
+		return resp, err
+	}
+	return FilesystemPath{
+		Path:     []FilesystemNode{{Type: "dir", Path: "/", Name: "/"}},
+		Children: buckets,
+	}, nil
+}
+
+// descend returns whether the directories at depth are listed
+func (w *walker) descend(depth int) bool {
+	return w.opts.MaxDepth <= 0 || depth < w.opts.MaxDepth
+}
+
+// filter returns whether a node is visited. rel is the path of the node
+// relative to the root of the walk
+func (w *walker) filter(rel string, node FilesystemNode) bool {
+	for _, pattern := range w.opts.Exclude {
+		if matchWalkPattern(pattern, rel) {
+			return false
+		}
+	}
+	if len(w.opts.Include) == 0 || node.IsDir() {
+		return true
+	}
+	for _, pattern := range w.opts.Include {
+		if matchWalkPattern(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchWalkPattern(pattern, rel string) bool {
+	var name = rel
+	if !strings.Contains(pattern, "/") {
+		name = path.Base(rel)
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// walkChild returns the path of a child node, relative to the root and absolute
+func walkChild(dir FSPath, rel string, node FilesystemNode) (string, FSPath, error) {
+	if rel != "" {
+		rel += "/"
+	}
+	fsp, err := dir.Join(node.Name)
+	return rel + node.Name, fsp, err
+}
+
+// stop ends an unsorted walk with an error. The caller must hold the lock
+func (w *walker) stop(err error) {
+	if !w.stopped.Load() {
+		w.stopped.Store(true)
+		w.err = err
+	}
+}
+
+// visitChildren calls fn for the children of a directory and starts listing
+// the subdirectories. The caller must hold the lock
+func (w *walker) visitChildren(dir FSPath, rel string, depth int, children []FilesystemNode) {
+	for _, node := range children {
+		if w.stopped.Load() {
+			return
+		}
+		childRel, fsp, joinErr := walkChild(dir, rel, node)
+		if !w.filter(childRel, node) {
+			continue
+		}
+		var err error
+		if joinErr != nil {
+			err = w.fn(dir.String()+"/"+node.Name, node, joinErr)
+		} else {
+			err = w.fn(fsp.String(), node, nil)
+		}
+
+		if err == fs.SkipDir {
+			if node.IsDir() {
+				continue
+			}
+			return
+		} else if err != nil {
+			w.stop(err)
+			return
+		}
+
+		if joinErr == nil && node.IsDir() && w.descend(depth+1) {
+			w.walkDir(fsp, childRel, depth+1, node)
+		}
+	}
+}
+
+// walkDir lists a directory in the background and visits its children when
+// the listing is done. The caller must hold the lock
+func (w *walker) walkDir(dir FSPath, rel string, depth int, node FilesystemNode) {
+	var listing = w.prefetch(dir)
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		<-listing.done
+		w.lock.Lock()
+		defer w.lock.Unlock()
+		if w.stopped.Load() {
+			return
+		} else if listing.err != nil {
+			if err := w.fn(dir.String(), node, listing.err); err != nil && err != fs.SkipDir {
+				w.stop(err)
+			}
+			return
+		}
+		w.visitChildren(dir, rel, depth, listing.resp.Children)
+	}()
+}
+
+// walkSorted visits the children of a directory in lexical order, depth
+// first. The subdirectories are listed before their turn so the listings can
+// run concurrently
+func (w *walker) walkSorted(dir FSPath, rel string, depth int, listing *walkListing) error {
+	var children = make([]FilesystemNode, len(listing.resp.Children))
+	copy(children, listing.resp.Children)
+	sort.Slice(children, func(i, j int) bool { return children[i].Name < children[j].Name })
+
+	type entry struct {
+		node    FilesystemNode
+		rel     string
+		path    FSPath
+		err     error
+		listing *walkListing
+	}
+	var entries = make([]entry, 0, len(children))
+	for _, node := range children {
+		var e = entry{node: node}
+		e.rel, e.path, e.err = walkChild(dir, rel, node)
+		if !w.filter(e.rel, node) {
+			continue
+		}
+		if e.err == nil && node.IsDir() && w.descend(depth+1) {
+			e.listing = w.prefetch(e.path)
+		}
+		entries = append(entries, e)
+	}
+	defer func() {
+		for _, e := range entries {
+			if e.listing != nil {
+				e.listing.canceled.Store(true)
+			}
+		}
+	}()
+
+	for i, e := range entries {
+		var err error
+		if e.err != nil {
+			err = w.fn(dir.String()+"/"+e.node.Name, e.node, e.err)
+		} else {
+			err = w.fn(e.path.String(), e.node, nil)
+		}
+
+		if err == fs.SkipDir {
+			if e.node.IsDir() {
+				// Don't request the listing of the skipped directory if it
+				// hasn't started yet
+				if e.listing != nil {
+					e.listing.canceled.Store(true)
+					entries[i].listing = nil
+				}
+				continue
+			}
+			return nil
+		} else if err != nil {
+			return err
+		} else if e.listing == nil {
+			continue
+		}
+
+		<-e.listing.done
+		entries[i].listing = nil
+		if e.listing.err != nil {
+			if err = w.fn(e.path.String(), e.node, e.listing.err); err != nil && err != fs.SkipDir {
+				return err
+			}
+		} else if err = w.walkSorted(e.path, e.rel, depth+1, e.listing); err != nil {
+			return err
+		}
+	}
+	return nil
+}
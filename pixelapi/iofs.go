@@ -0,0 +1,346 @@
+package pixelapi
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FS exposes a part of the filesystem API as an fs.FS, so it can be used with
+// functions like fs.WalkDir, fs.Glob, http.FS and template.ParseFS. It
+// implements fs.ReadDirFS, fs.StatFS and fs.ReadFileFS. Files opened through FS
+// also implement io.Seeker and io.ReaderAt.
+//
+// Directory listings are cached for a configurable time, so walking a tree
+// does not request the same directory multiple times. Changes made to the
+// filesystem after a directory was cached are not visible until the cache
+// expires. An FS is safe for concurrent use
+type FS struct {
+	api  PixelAPI
+	root FSPath
+	ttl  time.Duration
+
+	lock  sync.Mutex
+	cache map[string]fsCacheEntry
+	swept time.Time // Last time expired entries were removed from the cache
+}
+
+type fsCacheEntry struct {
+	path    FilesystemPath
+	fetched time.Time
+}
+
+// NewFS creates an fs.FS rooted at a filesystem path. If root is "/" the
+// buckets of the user are the top level directories. Directory listings are
+// cached for ttl, a ttl of zero disables the cache
+func NewFS(api PixelAPI, root string, ttl time.Duration) (*FS, error) {
+	fsp, err := ParseFSPath(root)
+	if err != nil {
+		return nil, err
+	}
+	return &FS{api: api, root: fsp, ttl: ttl, cache: make(map[string]fsCacheEntry)}, nil
+}
+
+// resolve converts an fs.FS name to a filesystem path
+func (f *FS) resolve(op, name string) (FSPath, error) {
+	if !fs.ValidPath(name) {
+		return FSPath{}, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return f.root, nil
+	}
+	fsp, err := f.root.Join(strings.Split(name, "/")...)
+	if err != nil {
+		return fsp, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return fsp, nil
+}
+
+// getPath returns the filesystem path from the cache, or requests it from the
+// API. The root path lists the user's buckets
+func (f *FS) getPath(fsp FSPath) (resp FilesystemPath, err error) {
+	var key = fsp.String()
+	f.lock.Lock()
+	entry, ok := f.cache[key]
+	f.lock.Unlock()
+	if ok && time.Since(entry.fetched) < f.ttl {
+		return entry.path, nil
+	}
+
+	if fsp.IsRoot() {
+		buckets, err := f.api.GetFilesystems()
+		if err != nil {
+			return resp, err
+		}
+		resp = FilesystemPath{
+			Path:     []FilesystemNode{{Type: "dir", Path: "/", Name: "/"}},
+			Children: buckets,
+		}
+	} else if resp, err = f.api.GetFilesystemPath(fsp.String()); err != nil {
+		return resp, err
+	}
+
+	if f.ttl > 0 {
+		var now = time.Now()
+		f.lock.Lock()
+		f.cache[key] = fsCacheEntry{path: resp, fetched: now}
+		// Remove expired entries once per ttl, so the cache does not keep
+		// every directory which was ever listed
+		if now.Sub(f.swept) >= f.ttl {
+			for k, entry := range f.cache {
+				if now.Sub(entry.fetched) >= f.ttl {
+					delete(f.cache, k)
+				}
+			}
+			f.swept = now
+		}
+		f.lock.Unlock()
+	}
+	return resp, nil
+}
+
+// Invalidate removes a path, its parent directory and everything below it from
+// the listing cache. Call it after changing the filesystem so the change is
+// visible through FS immediately
+func (f *FS) Invalidate(name string) {
+	fsp, err := f.resolve("invalidate", name)
+	if err != nil {
+		return
+	}
+	var key, parent = fsp.String(), fsp.Parent().String()
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for k := range f.cache {
+		if fsp.IsRoot() || k == key || k == parent || strings.HasPrefix(k, key+"/") {
+			delete(f.cache, k)
+		}
+	}
+}
+
+// stat returns the node at a path. If the listing of the parent directory is
+// cached the node is taken from there
+func (f *FS) stat(fsp FSPath) (FilesystemNode, error) {
+	if !fsp.IsRoot() {
+		f.lock.Lock()
+		entry, ok := f.cache[fsp.Parent().String()]
+		f.lock.Unlock()
+		if ok && time.Since(entry.fetched) < f.ttl {
+			for _, child := range entry.path.Children {
+				if child.Name == fsp.Base() {
+					return child, nil
+				}
+			}
+			return FilesystemNode{}, fs.ErrNotExist
+		}
+	}
+
+	resp, err := f.getPath(fsp)
+	if err != nil {
+		return FilesystemNode{}, err
+	}
+	return resp.Node(), nil
+}
+
+// Open implements fs.FS
+func (f *FS) Open(name string) (fs.File, error) {
+	fsp, err := f.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	node, err := f.stat(fsp)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	if node.IsDir() {
+		return &fsDir{fsys: f, path: fsp, name: name, node: node}, nil
+	}
+	return &fsFile{api: &f.api, path: fsp, node: node}, nil
+}
+
+// Stat implements fs.StatFS
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	fsp, err := f.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	node, err := f.stat(fsp)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return node.FileInfo(), nil
+}
+
+// ReadDir implements fs.ReadDirFS. The entries are sorted by name
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	fsp, err := f.resolve("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.getPath(fsp)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	} else if !resp.Node().IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return nodeDirEntries(resp.Children), nil
+}
+
+// ReadFile implements fs.ReadFileFS
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	file, err := f.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if _, ok := file.(*fsDir); ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+	return io.ReadAll(file)
+}
+
+func nodeDirEntries(nodes []FilesystemNode) []fs.DirEntry {
+	var entries = make([]fs.DirEntry, len(nodes))
+	for i := range nodes {
+		entries[i] = nodes[i].DirEntry()
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries
+}
+
+// fsFile is a file opened through FS. Sequential reads are streamed from a
+// single request, seeking closes the stream and the next read opens a new one
+// at the new offset
+type fsFile struct {
+	api    *PixelAPI
+	path   FSPath
+	node   FilesystemNode
+	offset int64
+	body   io.ReadCloser
+	remote *RemoteFile
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) { return f.node.FileInfo(), nil }
+
+func (f *fsFile) Read(b []byte) (n int, err error) {
+	if f.offset >= int64(f.node.FileSize) {
+		return 0, io.EOF
+	}
+	if f.body == nil {
+		file, err := f.api.OpenFilesystemFile(f.path.String(), FilesystemReadOptions{Offset: f.offset})
+		if err != nil {
+			return 0, err
+		}
+		f.body = file
+	}
+	n, err = f.body.Read(b)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *fsFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(f.node.FileSize)
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative seek position")
+	}
+	if offset != f.offset && f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *fsFile) ReadAt(b []byte, off int64) (int, error) {
+	if f.remote == nil {
+		f.remote = f.api.openRemoteFile("filesystem/"+f.path.Escaped(), int64(f.node.FileSize))
+	}
+	return f.remote.ReadAt(b, off)
+}
+
+func (f *fsFile) Close() error {
+	if f.remote != nil {
+		f.remote.Close()
+	}
+	if f.body != nil {
+		return f.body.Close()
+	}
+	return nil
+}
+
+// fsDir is a directory opened through FS
+type fsDir struct {
+	fsys    *FS
+	path    FSPath
+	name    string
+	node    FilesystemNode
+	entries []fs.DirEntry // Remaining entries, nil until the first ReadDir
+	read    bool
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) { return d.node.FileInfo(), nil }
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *fsDir) Close() error { return nil }
+
+// ReadDir implements fs.ReadDirFile
+func (d *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		resp, err := d.fsys.getPath(d.path)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: err}
+		}
+		d.entries = nodeDirEntries(resp.Children)
+		d.read = true
+	}
+
+	if n <= 0 {
+		var entries = d.entries
+		d.entries = nil
+		return entries, nil
+	} else if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	var entries = d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+// FileInfo returns the node as an fs.FileInfo
+func (n FilesystemNode) FileInfo() fs.FileInfo { return nodeInfo{n} }
+
+// DirEntry returns the node as an fs.DirEntry
+func (n FilesystemNode) DirEntry() fs.DirEntry { return nodeInfo{n} }
+
+// nodeInfo adapts a FilesystemNode to fs.FileInfo and fs.DirEntry
+type nodeInfo struct {
+	node FilesystemNode
+}
+
+func (i nodeInfo) Name() string               { return i.node.Name }
+func (i nodeInfo) Size() int64                { return int64(i.node.FileSize) }
+func (i nodeInfo) ModTime() time.Time         { return i.node.Modified }
+func (i nodeInfo) Mode() fs.FileMode          { return i.node.Mode() }
+func (i nodeInfo) IsDir() bool                { return i.node.IsDir() }
+func (i nodeInfo) Sys() any                   { return i.node }
+func (i nodeInfo) Type() fs.FileMode          { return i.Mode().Type() }
+func (i nodeInfo) Info() (fs.FileInfo, error) { return i, nil }
+func (i nodeInfo) String() string             { return fs.FormatFileInfo(i) }
@@ -1,9 +1,15 @@
 package pixelapi
 
 import (
+	"errors"
+	"fmt"
 	"time"
 )
 
+// ErrListNotEditable is returned when trying to change a list which the user
+// is not allowed to edit
+var ErrListNotEditable = errors.New("list is not editable by this user")
+
 // ListID is returned when a list has been sucessfully created
 type ListID struct {
 	ID string `json:"id"`
@@ -26,7 +32,89 @@ type ListFile struct {
 	FileInfo    `json:""`
 }
 
+// ListFileInput is a file in a list which is being created or updated
+type ListFileInput struct {
+	ID          string `json:"id"`
+	Description string `json:"description,omitempty"`
+}
+
+// Input returns the list file as input for CreateList or UpdateList, keeping
+// its description
+func (f ListFile) Input() ListFileInput {
+	return ListFileInput{ID: f.ID, Description: f.Description}
+}
+
+// Inputs returns the files in the list as input for UpdateList, in the same
+// order and with the same descriptions
+func (l ListInfo) Inputs() []ListFileInput {
+	var files = make([]ListFileInput, len(l.Files))
+	for i := range l.Files {
+		files[i] = l.Files[i].Input()
+	}
+	return files
+}
+
+// listRequest is the request body for creating and updating lists
+type listRequest struct {
+	Title     string          `json:"title"`
+	Anonymous bool            `json:"anonymous"`
+	Files     []ListFileInput `json:"files"`
+}
+
+func validateListFiles(files []ListFileInput) error {
+	for i, f := range files {
+		if f.ID == "" {
+			return fmt.Errorf("list file %d has no ID", i)
+		}
+	}
+	return nil
+}
+
 // GetListID get a List from the pixeldrain API
 func (p *PixelAPI) GetListID(id string) (resp ListInfo, err error) {
 	return resp, p.jsonRequest("GET", "list/"+id, &resp)
 }
+
+// CreateList creates a list of files. The files will be shown in the given
+// order. If the client is not logged in the list is created anonymously
+func (p *PixelAPI) CreateList(title string, files []ListFileInput) (resp ListID, err error) {
+	if err = validateListFiles(files); err != nil {
+		return resp, err
+	}
+	return resp, p.jsonBody(
+		"POST", "list",
+		listRequest{Title: title, Anonymous: p.key == "", Files: files},
+		&resp,
+	)
+}
+
+// editableList gets a list and checks if the user is allowed to edit it
+func (p *PixelAPI) editableList(id string) (list ListInfo, err error) {
+	if list, err = p.GetListID(id); err != nil {
+		return list, err
+	} else if !list.CanEdit {
+		return list, fmt.Errorf("list %s: %w", id, ErrListNotEditable)
+	}
+	return list, nil
+}
+
+// UpdateList replaces the title and files of a list. The files will be shown in
+// the given order, use ListInfo.Inputs to start from the current contents of
+// the list. ErrListNotEditable is returned if the user cannot edit the list
+func (p *PixelAPI) UpdateList(id, title string, files []ListFileInput) (err error) {
+	if err = validateListFiles(files); err != nil {
+		return err
+	} else if _, err = p.editableList(id); err != nil {
+		return err
+	}
+	return p.jsonBody("PUT", "list/"+id, listRequest{Title: title, Files: files}, nil)
+}
+
+// DeleteList deletes a list. The files in the list are not deleted.
+// ErrListNotEditable is returned if the user cannot edit the list
+func (p *PixelAPI) DeleteList(id string) (err error) {
+	if _, err = p.editableList(id); err != nil {
+		return err
+	}
+	return p.jsonRequest("DELETE", "list/"+id, nil)
+}
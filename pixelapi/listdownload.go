@@ -0,0 +1,285 @@
+package pixelapi
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ListManifestName is the name of the manifest file DownloadList writes
+const ListManifestName = "manifest.json"
+
+// ListManifest describes the files DownloadList downloaded
+type ListManifest struct {
+	ID    string             `json:"id"`
+	Title string             `json:"title"`
+	Files []ListManifestFile `json:"files"`
+}
+
+// ListManifestFile is a file which was downloaded from a list
+type ListManifestFile struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Size        ByteSize `json:"size"`
+	SHA256      string   `json:"sha256"`
+}
+
+// partSuffix is added to the name of a file while it's being downloaded
+const partSuffix = ".part"
+
+// reservedListFileName returns whether DownloadList uses a file name for
+// itself. The manifest and partial downloads must not collide with list files
+func reservedListFileName(name string) bool {
+	name = strings.ToLower(name)
+	return name == ListManifestName || strings.HasSuffix(name, partSuffix)
+}
+
+// listNameKey returns the key under which a file name is unique. Names are
+// compared case insensitively, so the names DownloadList picks don't collide on
+// case insensitive filesystems
+func listNameKey(name string) string { return strings.ToLower(name) }
+
+// listFileNames returns a unique, safe file name for every file in a list. The
+// names are assigned in list order, so the result is always the same for the
+// same list. When names collide a number is added before the extension, like
+// "photo (2).jpg". Names are compared case-insensitively because not all
+// filesystems are case sensitive. Files named like the manifest get a number
+// too, and files ending in .part get the number after the extension so they
+// don't look like partial downloads
+func listFileNames(files []ListFile) []string {
+	var names = make([]string, len(files))
+	var taken = make(map[string]struct{}, len(files))
+	for i, f := range files {
+		var name = strings.NewReplacer("/", "_", "\\", "_", "\x00", "_").Replace(f.Name)
+		if name == "" || name == "." || name == ".." {
+			name = f.ID
+		}
+
+		var ext = filepath.Ext(name)
+		if strings.EqualFold(ext, partSuffix) {
+			ext = ""
+		}
+		var base = strings.TrimSuffix(name, ext)
+		for n := 2; ; n++ {
+			if _, ok := taken[listNameKey(name)]; !ok && !reservedListFileName(name) {
+				break
+			}
+			name = base + " (" + strconv.Itoa(n) + ")" + ext
+		}
+		taken[listNameKey(name)] = struct{}{}
+		names[i] = name
+	}
+	return names
+}
+
+// DownloadList downloads all files in a list to a directory. Files are
+// downloaded concurrently and their SHA-256 checksums are verified. Files which
+// are already present with the right checksum are skipped, and interrupted
+// downloads are resumed from a .part file. When the downloads are done a
+// manifest describing the downloaded files is written to ListManifestName in
+// the same directory.
+//
+// Files are named after the name they have in the list. If multiple files have
+// the same name a number is added to the name, like "photo (2).jpg". The
+// manifest contains the files which were downloaded successfully, errors for
+// other files are joined in the returned error
+func (p *PixelAPI) DownloadList(id, dir string) (manifest ListManifest, err error) {
+	list, err := p.GetListID(id)
+	if err != nil {
+		return manifest, err
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return manifest, fmt.Errorf("failed to create download directory: %w", err)
+	}
+
+	var names = listFileNames(list.Files)
+	var errs = make([]error, len(list.Files))
+	var wg sync.WaitGroup
+	var sem = make(chan struct{}, batchConcurrency)
+	for i := range list.Files {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() { <-sem; wg.Done() }()
+			errs[i] = p.downloadListFile(list.Files[i].FileInfo, filepath.Join(dir, names[i]))
+		}(i)
+	}
+	wg.Wait()
+
+	manifest = ListManifest{ID: list.ID, Title: list.Title, Files: []ListManifestFile{}}
+	for i, f := range list.Files {
+		if errs[i] != nil {
+			errs[i] = fmt.Errorf("file %s (%s): %w", f.ID, names[i], errs[i])
+			continue
+		}
+		manifest.Files = append(manifest.Files, ListManifestFile{
+			ID:          f.ID,
+			Name:        names[i],
+			Description: f.Description,
+			Size:        f.Size,
+			SHA256:      f.HashSHA256,
+		})
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "\t")
+	if err != nil {
+		return manifest, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err = writeFileAtomic(filepath.Join(dir, ListManifestName), data); err != nil {
+		return manifest, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return manifest, errors.Join(errs...)
+}
+
+// downloadListFile downloads a single file to path. If path already exists and
+// matches the checksum nothing is downloaded. The download is written to a
+// .part file first, if that file already exists the download continues where
+// it left off
+func (p *PixelAPI) downloadListFile(info FileInfo, path string) error {
+	if sum, err := hashFile(path); err == nil && strings.EqualFold(sum, info.HashSHA256) {
+		return nil // Already downloaded
+	}
+
+	var partPath = path + partSuffix
+	part, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer part.Close()
+
+	// Hash the data we already have, this also moves the file offset to the
+	// end so we can append the rest
+	var hasher = sha256.New()
+	have, err := io.Copy(hasher, part)
+	if err != nil {
+		return fmt.Errorf("failed to read partial download: %w", err)
+	}
+
+	if have > int64(info.Size) {
+		// The partial file is larger than the real file, start over
+		if err = part.Truncate(0); err != nil {
+			return err
+		} else if _, err = part.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		hasher.Reset()
+		have = 0
+	}
+
+	if have < int64(info.Size) {
+		var body io.ReadCloser
+		if have == 0 {
+			resp, err := p.rawRequest("GET", "file/"+info.ID, nil)
+			if err != nil {
+				return err
+			}
+			body = resp.Body
+		} else if body, err = p.getRange("file/"+info.ID, have, int64(info.Size)-have); err != nil {
+			return err
+		}
+		defer body.Close()
+
+		if _, err = io.Copy(io.MultiWriter(part, hasher), body); err != nil {
+			return fmt.Errorf("download failed: %w", err)
+		}
+	}
+
+	if err = part.Close(); err != nil {
+		return err
+	}
+	if info.HashSHA256 != "" && !strings.EqualFold(hex.EncodeToString(hasher.Sum(nil)), info.HashSHA256) {
+		// The partial file can't be trusted, remove it so the next attempt
+		// starts from scratch
+		os.Remove(partPath)
+		return ErrChecksumMismatch
+	}
+	return os.Rename(partPath, path)
+}
+
+// hashFile returns the hex encoded SHA-256 checksum of a file
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var hasher = sha256.New()
+	if _, err = io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// StreamListZip writes all files in a list to w as a single zip archive. If the
+// API can create the archive it is streamed directly from the API. Otherwise
+// the archive is built on the fly from the separate files, in which case the
+// checksums of the files are verified as they are written. File names in the
+// archive are the same as DownloadList would use
+func (p *PixelAPI) StreamListZip(id string, w io.Writer) error {
+	resp, err := p.rawRequest("GET", "list/"+id+"/zip", nil)
+	if err == nil {
+		defer resp.Body.Close()
+		if _, err = io.Copy(w, resp.Body); err != nil {
+			return fmt.Errorf("failed to stream list zip: %w", err)
+		}
+		return nil
+	}
+
+	// Only fall back to building the zip ourselves if the API does not support
+	// zips for this list
+	var apierr Error
+	if !errors.As(err, &apierr) || (apierr.Status != http.StatusNotFound &&
+		apierr.Status != http.StatusMethodNotAllowed &&
+		apierr.Status != http.StatusNotImplemented) {
+		return err
+	}
+
+	list, err := p.GetListID(id)
+	if err != nil {
+		return err
+	}
+
+	var zw = zip.NewWriter(w)
+	for i, name := range listFileNames(list.Files) {
+		if err = p.writeZipFile(zw, list.Files[i].FileInfo, name); err != nil {
+			return fmt.Errorf("file %s (%s): %w", list.Files[i].ID, name, err)
+		}
+	}
+	return zw.Close()
+}
+
+func (p *PixelAPI) writeZipFile(zw *zip.Writer, info FileInfo, name string) error {
+	resp, err := p.rawRequest("GET", "file/"+info.ID, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	fw, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: info.DateUpload,
+	})
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader = resp.Body
+	if info.HashSHA256 != "" {
+		body = &hashVerifier{r: resp.Body, hash: sha256.New(), expected: info.HashSHA256}
+	}
+	_, err = io.Copy(fw, body)
+	return err
+}
@@ -0,0 +1,152 @@
+package pixelapi
+
+import (
+	"bufio"
+	"encoding/csv"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileURL returns the download URL of a file
+func (p *PixelAPI) FileURL(id string) string {
+	return p.apiEndpoint + "/file/" + id
+}
+
+// apiURL turns a link returned by the API into an absolute URL. Links which are
+// already absolute are returned unchanged
+func (p *PixelAPI) apiURL(href string) string {
+	if href == "" || strings.HasPrefix(href, "http://") || strings.HasPrefix(href, "https://") {
+		return href
+	}
+	return p.apiEndpoint + "/" + strings.TrimPrefix(href, "/")
+}
+
+// listFileTitle returns the description of a list file, or the file name if it
+// has no description
+func listFileTitle(f ListFile) string {
+	if f.Description != "" {
+		return f.Description
+	}
+	return f.Name
+}
+
+// WriteListM3U writes the audio and video files in a list as an extended M3U
+// playlist. The playlist is UTF-8 encoded, so it can be saved as .m3u8. Files
+// are titled with their description, or their name if they have none
+func (p *PixelAPI) WriteListM3U(w io.Writer, list ListInfo) error {
+	var bw = bufio.NewWriter(w)
+	bw.WriteString("#EXTM3U\n")
+	if list.Title != "" {
+		bw.WriteString("#PLAYLIST:" + oneLine(list.Title) + "\n")
+	}
+	for _, f := range list.Files {
+		if !strings.HasPrefix(f.MimeType, "audio/") && !strings.HasPrefix(f.MimeType, "video/") {
+			continue
+		}
+		bw.WriteString("#EXTINF:-1," + oneLine(listFileTitle(f)) + "\n")
+		bw.WriteString(p.FileURL(f.ID) + "\n")
+	}
+	return bw.Flush()
+}
+
+// oneLine replaces line breaks so a string can be used in a line based format
+func oneLine(s string) string {
+	return strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(s)
+}
+
+var listGalleryTemplate = template.Must(template.New("gallery").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; background: #222; color: #eee; }
+.gallery { display: flex; flex-wrap: wrap; gap: 16px; }
+.file { width: 160px; text-align: center; word-wrap: break-word; }
+.file a { color: #eee; text-decoration: none; }
+.file img { width: 128px; height: 128px; object-fit: contain; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="gallery">
+{{- range .Files}}
+<div class="file">
+<a href="{{.URL}}"><img src="{{.Thumbnail}}" alt="{{.Name}}" loading="lazy"><br>{{.Name}}</a>
+{{- if .Description}}<p>{{.Description}}</p>{{end}}
+</div>
+{{- end}}
+</div>
+</body>
+</html>
+`))
+
+// WriteListHTMLGallery writes a static HTML page showing the thumbnails of all
+// files in a list. Every thumbnail links to the file
+func (p *PixelAPI) WriteListHTMLGallery(w io.Writer, list ListInfo) error {
+	type galleryFile struct {
+		Name, Description, URL, Thumbnail string
+	}
+	var files = make([]galleryFile, len(list.Files))
+	for i, f := range list.Files {
+		files[i] = galleryFile{
+			Name:        f.Name,
+			Description: f.Description,
+			URL:         p.FileURL(f.ID),
+			Thumbnail:   p.apiURL(f.ThumbnailHREF),
+		}
+	}
+	return listGalleryTemplate.Execute(w, struct {
+		Title string
+		Files []galleryFile
+	}{Title: list.Title, Files: files})
+}
+
+// WriteListCSV writes an inventory of the files in a list as CSV, with a header
+// row. The files are written in list order
+func (p *PixelAPI) WriteListCSV(w io.Writer, list ListInfo) error {
+	var cw = csv.NewWriter(w)
+	cw.Write([]string{
+		"id", "name", "description", "size", "mime_type", "date_upload", "sha256", "url",
+	})
+	for _, f := range list.Files {
+		cw.Write([]string{
+			f.ID,
+			f.Name,
+			f.Description,
+			strconv.FormatInt(int64(f.Size), 10),
+			f.MimeType,
+			f.DateUpload.UTC().Format(time.RFC3339),
+			f.HashSHA256,
+			p.FileURL(f.ID),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteListSHA256Sums writes the checksums of the files in a list in the format
+// of the sha256sum tool. The file names are the same names DownloadList uses,
+// so the output can be used to verify a downloaded list with sha256sum -c.
+// Files without a checksum are left out
+func WriteListSHA256Sums(w io.Writer, list ListInfo) error {
+	var bw = bufio.NewWriter(w)
+	for i, name := range listFileNames(list.Files) {
+		var sum = strings.ToLower(list.Files[i].HashSHA256)
+		if sum == "" {
+			continue
+		}
+
+		// sha256sum escapes names with backslashes and newlines, and marks
+		// the line with a leading backslash
+		if strings.ContainsAny(name, "\\\n\r") {
+			name = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r").Replace(name)
+			bw.WriteString("\\")
+		}
+		bw.WriteString(sum + "  " + name + "\n")
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,183 @@
+package pixelapi
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ListSyncAction is what SyncList does with a file
+type ListSyncAction string
+
+// Actions SyncList can take
+const (
+	// The local file is already in the list
+	ListSyncKeep ListSyncAction = "keep"
+	// The local file is not in the list yet, it's uploaded and appended
+	ListSyncUpload ListSyncAction = "upload"
+	// The local file has changed, it's uploaded and takes the place of the
+	// old file in the list
+	ListSyncReplace ListSyncAction = "replace"
+	// The file is in the list but not in the local directory, it's removed
+	// from the list. The file itself is not deleted
+	ListSyncRemove ListSyncAction = "remove"
+)
+
+// ListSyncStep is a single step in a list synchronization plan
+type ListSyncStep struct {
+	Action ListSyncAction
+	// Name of the local file. For removals this is the name of the file in
+	// the list
+	Name string
+	// ID of the file in the list. For uploads this is the ID of the new file
+	// after the upload is done
+	FileID string
+}
+
+// String returns the step in human readable form, like "upload  photo.jpg"
+func (s ListSyncStep) String() string {
+	return fmt.Sprintf("%-7s %s", s.Action, s.Name)
+}
+
+// ListSyncOptions changes the behaviour of SyncList
+type ListSyncOptions struct {
+	// DryRun makes SyncList only return the plan without uploading files or
+	// changing the list. Print the steps to show what a sync would do
+	DryRun bool
+
+	// Deduplicate is passed to PutFile when uploading files
+	Deduplicate *Deduplicator
+}
+
+// SyncList makes a list mirror the regular files in a local directory.
+// Subdirectories, hidden files and the manifest and partial downloads of
+// DownloadList are ignored. Files are matched by name and SHA-256 checksum:
+//
+//   - Files which have the same name and checksum in the list are kept
+//   - Files which have the same name but a different checksum are uploaded and
+//     replace the old file at the same position in the list
+//   - Files which are not in the list are uploaded, unless a file with the same
+//     checksum is in the list under another name. New files are added to the
+//     end of the list in alphabetical order
+//   - Files in the list which are not in the directory are removed from the
+//     list
+//
+// The order of the files which are kept is not changed. File names in the list
+// are matched the same way DownloadList names them, ignoring case, so a
+// directory downloaded with DownloadList is in sync with its list, also on case
+// insensitive filesystems. If the directory contains multiple files which only
+// differ in case the first one in alphabetical order is matched, the others are
+// treated as new files. The returned plan contains a step for every file
+func (p *PixelAPI) SyncList(id, dir string, opts ListSyncOptions) (plan []ListSyncStep, err error) {
+	list, err := p.editableList(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Hash the local files
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sync directory: %w", err)
+	}
+	type localFile struct{ name, sum string }
+	var local = make(map[string]localFile) // Name key to file
+	var localFiles []localFile             // In alphabetical order
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") ||
+			reservedListFileName(entry.Name()) {
+			continue
+		}
+		sum, err := hashFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash '%s': %w", entry.Name(), err)
+		}
+		localFiles = append(localFiles, localFile{name: entry.Name(), sum: sum})
+	}
+	sort.Slice(localFiles, func(i, j int) bool { return localFiles[i].name < localFiles[j].name })
+	for _, f := range localFiles {
+		if _, ok := local[listNameKey(f.name)]; !ok {
+			local[listNameKey(f.name)] = f
+		}
+	}
+
+	// Walk through the list and decide what happens with every file
+	var files = list.Inputs()
+	var matched = make(map[string]bool, len(local))
+	var removed = make(map[string]int) // Checksum to list index
+	for i, name := range listFileNames(list.Files) {
+		var step = ListSyncStep{Name: name, FileID: list.Files[i].ID}
+		if f, ok := local[listNameKey(name)]; !ok {
+			step.Action = ListSyncRemove
+			removed[strings.ToLower(list.Files[i].HashSHA256)] = i
+		} else if strings.EqualFold(f.sum, list.Files[i].HashSHA256) {
+			step.Action, step.Name = ListSyncKeep, f.name
+			matched[f.name] = true
+		} else {
+			step.Action, step.Name = ListSyncReplace, f.name
+			matched[f.name] = true
+		}
+		plan = append(plan, step)
+	}
+
+	// Local files which were not matched by name are either renamed list files
+	// or new files
+	for _, f := range localFiles {
+		if matched[f.name] {
+			continue
+		}
+		if i, ok := removed[f.sum]; ok {
+			plan[i] = ListSyncStep{Action: ListSyncKeep, Name: f.name, FileID: list.Files[i].ID}
+			delete(removed, f.sum)
+			continue
+		}
+		plan = append(plan, ListSyncStep{Action: ListSyncUpload, Name: f.name})
+	}
+
+	var changed = false
+	for _, step := range plan {
+		changed = changed || step.Action != ListSyncKeep
+	}
+	if opts.DryRun || !changed {
+		return plan, nil
+	}
+
+	// Execute the plan. Steps which refer to existing list files are in the
+	// same order as the list, new files come after that
+	var newFiles = make([]ListFileInput, 0, len(plan))
+	for i := range plan {
+		switch plan[i].Action {
+		case ListSyncKeep:
+			newFiles = append(newFiles, files[i])
+		case ListSyncReplace, ListSyncUpload:
+			if plan[i].FileID, err = p.syncListUpload(dir, plan[i].Name, opts); err != nil {
+				return plan, err
+			}
+			var input = ListFileInput{ID: plan[i].FileID}
+			if plan[i].Action == ListSyncReplace {
+				input.Description = files[i].Description
+			}
+			newFiles = append(newFiles, input)
+		}
+	}
+
+	if err = p.UpdateList(id, list.Title, newFiles); err != nil {
+		return plan, fmt.Errorf("failed to update list: %w", err)
+	}
+	return plan, nil
+}
+
+func (p *PixelAPI) syncListUpload(dir, name string, opts ListSyncOptions) (id string, err error) {
+	file, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	resp, _, err := p.PutFile(name, file, UploadOptions{Deduplicate: opts.Deduplicate})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload '%s': %w", name, err)
+	}
+	return resp.ID, nil
+}
@@ -0,0 +1,140 @@
+package pixelapi_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"fornaxian.tech/pixeldrain_api_client/pixelapi"
+)
+
+// newListServer serves a single editable list with the given file names and
+// contents. Files are served with support for range requests
+func newListServer(t *testing.T, names, contents []string) *httptest.Server {
+	var list = pixelapi.ListInfo{ID: "list", Title: "Test list", CanEdit: true}
+	var data = make(map[string]string)
+	for i := range names {
+		var sum = sha256.Sum256([]byte(contents[i]))
+		var id = "file" + string(rune('a'+i))
+		data[id] = contents[i]
+		list.Files = append(list.Files, pixelapi.ListFile{FileInfo: pixelapi.FileInfo{
+			ID:         id,
+			Name:       names[i],
+			Size:       pixelapi.ByteSize(len(contents[i])),
+			HashSHA256: hex.EncodeToString(sum[:]),
+		}})
+	}
+
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/list/list":
+			json.NewEncoder(w).Encode(list)
+		case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/file/"):
+			content, ok := data[strings.TrimPrefix(r.URL.Path, "/file/")]
+			if !ok {
+				http.Error(w, `{"success":false,"value":"not_found"}`, http.StatusNotFound)
+				return
+			}
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			http.Error(w, `{"success":false,"value":"method_not_allowed"}`, http.StatusMethodNotAllowed)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSyncListAfterDownloadList(t *testing.T) {
+	var names = []string{"photo.jpg", "photo.jpg", "manifest.json", "video", "video.part", "notes.txt"}
+	var contents = []string{"one", "two", "{}", "frames", "partial", "text"}
+	var api = pixelapi.New(newListServer(t, names, contents).URL)
+	var dir = t.TempDir()
+
+	manifest, err := api.DownloadList("list", dir)
+	if err != nil {
+		t.Fatalf("DownloadList: %s", err)
+	} else if len(manifest.Files) != len(names) {
+		t.Fatalf("manifest has %d files, expected %d", len(manifest.Files), len(names))
+	}
+
+	// The list files named like the manifest and a partial download must
+	// not be overwritten by them
+	for _, f := range manifest.Files {
+		data, err := os.ReadFile(filepath.Join(dir, f.Name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sum = sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != f.SHA256 {
+			t.Errorf("file %s has the wrong contents %q", f.Name, data)
+		}
+	}
+
+	// Leave a partial download behind, SyncList must ignore it
+	if err = os.WriteFile(filepath.Join(dir, "other.bin.part"), []byte("junk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := api.SyncList("list", dir, pixelapi.ListSyncOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("SyncList: %s", err)
+	} else if len(plan) != len(names) {
+		t.Fatalf("plan has %d steps, expected %d: %v", len(plan), len(names), plan)
+	}
+	for _, step := range plan {
+		if step.Action != pixelapi.ListSyncKeep {
+			t.Errorf("expected %s to be kept, got %s", step.Name, step.Action)
+		}
+	}
+
+	// A second download finds all files present and doesn't change them
+	if _, err = api.DownloadList("list", dir); err != nil {
+		t.Fatalf("second DownloadList: %s", err)
+	}
+	if plan, err = api.SyncList("list", dir, pixelapi.ListSyncOptions{DryRun: true}); err != nil {
+		t.Fatalf("SyncList: %s", err)
+	}
+	for _, step := range plan {
+		if step.Action != pixelapi.ListSyncKeep {
+			t.Errorf("after second download expected %s to be kept, got %s", step.Name, step.Action)
+		}
+	}
+}
+
+func TestSyncListIgnoresCase(t *testing.T) {
+	var names = []string{"Photo.jpg", "photo.JPG", "Notes.txt"}
+	var contents = []string{"one", "two", "text"}
+	var api = pixelapi.New(newListServer(t, names, contents).URL)
+	var dir = t.TempDir()
+
+	// Like a case insensitive filesystem which kept the case the files were
+	// first created with
+	var local = map[string]string{"PHOTO.JPG": "one", "Photo (2).jpg": "two", "notes.txt": "changed"}
+	for name, content := range local {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plan, err := api.SyncList("list", dir, pixelapi.ListSyncOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("SyncList: %s", err)
+	}
+	var expected = []string{"keep    PHOTO.JPG", "keep    Photo (2).jpg", "replace notes.txt"}
+	if len(plan) != len(expected) {
+		t.Fatalf("plan has %d steps, expected %d: %v", len(plan), len(expected), plan)
+	}
+	for i := range plan {
+		if plan[i].String() != expected[i] {
+			t.Errorf("step %d is %q, expected %q", i, plan[i], expected[i])
+		}
+	}
+}
@@ -8,9 +8,9 @@ type Patron struct {
 	FullName                string           `json:"full_name"`
 	LastChargeDate          time.Time        `json:"last_charge_date"`
 	LastChargeStatus        string           `json:"last_charge_status"`
-	LifetimeSupportCents    int              `json:"lifetime_support_cents"`
+	LifetimeSupportCents    CentsEUR         `json:"lifetime_support_cents"`
 	PatronStatus            string           `json:"patron_status"`
-	PledgeAmountCents       int              `json:"pledge_amount_cents"`
+	PledgeAmountCents       CentsEUR         `json:"pledge_amount_cents"`
 	PledgeRelationshipStart time.Time        `json:"pledge_relationship_start"`
 	UserEmail               string           `json:"user_email"`
 	Subscription            SubscriptionType `json:"subscription"`
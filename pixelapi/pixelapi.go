@@ -1,10 +1,13 @@
 package pixelapi
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net"
 	"net/http"
 	"net/url"
@@ -19,6 +22,9 @@ type PixelAPI struct {
 	key         string
 	realIP      string
 	realAgent   string
+
+	thumbnailCacheDir string
+	downloadCache     *DownloadCache
 }
 
 // New creates a new Pixeldrain API client to query the Pixeldrain API with
@@ -87,31 +93,41 @@ type Error struct {
 
 func (e Error) Error() string { return e.StatusCode }
 
-// ErrIsServerError returns true if the error is a server-side error
-func ErrIsServerError(err error) bool {
-	if apierr, ok := err.(Error); ok && apierr.Status >= 500 {
-		return true
+// Is makes errors.Is match API errors with the standard filesystem errors.
+// Not found errors match fs.ErrNotExist, already exists errors match
+// fs.ErrExist and forbidden errors match fs.ErrPermission
+func (e Error) Is(target error) bool {
+	switch target {
+	case fs.ErrNotExist:
+		return e.Status == http.StatusNotFound
+	case fs.ErrExist:
+		return e.StatusCode == ErrCodeAlreadyExists
+	case fs.ErrPermission:
+		return e.Status == http.StatusForbidden || e.Status == http.StatusUnauthorized
 	}
 	return false
 }
 
+// ErrIsServerError returns true if the error is a server-side error
+func ErrIsServerError(err error) bool {
+	var apierr Error
+	return errors.As(err, &apierr) && apierr.Status >= 500
+}
+
 // ErrIsClientError returns true if the error is a client-side error
 func ErrIsClientError(err error) bool {
-	if apierr, ok := err.(Error); ok && apierr.Status >= 400 && apierr.Status < 500 {
-		return true
-	}
-	return false
+	var apierr Error
+	return errors.As(err, &apierr) && apierr.Status >= 400 && apierr.Status < 500
 }
 
-// ErrIsClientError returns true if the error is a client-side error
+// ErrIsNotFound returns true if the error is a not found error
 func ErrIsNotFound(err error) bool {
-	if apierr, ok := err.(Error); ok && apierr.Status == 404 {
-		return true
-	}
-	return false
+	var apierr Error
+	return errors.As(err, &apierr) && apierr.Status == 404
 }
 
-func (p *PixelAPI) do(r *http.Request) (*http.Response, error) {
+// setHeaders adds the authentication and proxy headers to a request
+func (p *PixelAPI) setHeaders(r *http.Request) {
 	if p.key != "" {
 		r.SetBasicAuth("", p.key)
 	}
@@ -121,7 +137,10 @@ func (p *PixelAPI) do(r *http.Request) (*http.Response, error) {
 	if p.realAgent != "" {
 		r.Header.Set("User-Agent", p.realAgent)
 	}
+}
 
+func (p *PixelAPI) do(r *http.Request) (*http.Response, error) {
+	p.setHeaders(r)
 	return p.client.Do(r)
 }
 
@@ -138,6 +157,31 @@ func (p *PixelAPI) getRaw(path string) (io.ReadCloser, error) {
 	return resp.Body, err
 }
 
+// rawRequest makes a request with extra headers and returns the response. If
+// the API responded with an error status the error is parsed and returned
+// instead. Don't forget to close the response body!
+func (p *PixelAPI) rawRequest(method, path string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, p.apiEndpoint+"/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := p.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		if err = parseJSONResponse(resp, nil); err != nil {
+			return nil, fmt.Errorf("API error for %s '%s': %w", method, path, err)
+		}
+	}
+	return resp, nil
+}
+
 func (p *PixelAPI) jsonRequest(method, path string, target any) error {
 	req, err := http.NewRequest(method, p.apiEndpoint+"/"+path, nil)
 	if err != nil {
@@ -174,6 +218,37 @@ func (p *PixelAPI) form(method, path string, vals url.Values, target any) error
 	return nil
 }
 
+// bodyRequest makes a request with a raw request body and parses the JSON
+// response into target
+func (p *PixelAPI) bodyRequest(method, path, contentType string, body io.Reader, target any) error {
+	req, err := http.NewRequest(method, p.apiEndpoint+"/"+path, body)
+	if err != nil {
+		return fmt.Errorf("prepare request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := p.do(req)
+	if err != nil {
+		return fmt.Errorf("do request failed: %w", err)
+	}
+
+	defer resp.Body.Close()
+	if err = parseJSONResponse(resp, target); err != nil {
+		return fmt.Errorf("failed to parse API response for %s '%s': %w", method, path, err)
+	}
+	return nil
+}
+
+// jsonBody makes a request with a JSON encoded request body and parses the
+// JSON response into target
+func (p *PixelAPI) jsonBody(method, path string, body any, target any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode request body: %w", err)
+	}
+	return p.bodyRequest(method, path, "application/json", bytes.NewReader(data), target)
+}
+
 func parseJSONResponse(resp *http.Response, target any) (err error) {
 	// Test for client side and server side errors
 	if resp.StatusCode >= 400 {
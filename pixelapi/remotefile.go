@@ -0,0 +1,199 @@
+package pixelapi
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+const (
+	// remoteFileBlockSize is the amount of data a RemoteFile requests at once
+	// for small reads. Reading whole blocks acts as read-ahead for sequential
+	// access
+	remoteFileBlockSize = 256 * 1024
+
+	// remoteFileCacheBlocks is the number of blocks a RemoteFile keeps in
+	// memory
+	remoteFileCacheBlocks = 8
+)
+
+// RemoteFile provides random access to a file on pixeldrain. It implements
+// io.ReaderAt, io.ReadSeeker and io.Closer. Data is fetched with HTTP Range
+// requests, which reuse the connections of the API client. Small reads are
+// rounded up to whole blocks which are kept in a small cache, so sequential
+// reads and reads close to each other don't need a request each.
+//
+// ReadAt is safe for concurrent use, Read and Seek share an offset and are not
+type RemoteFile struct {
+	p      *PixelAPI
+	path   string
+	size   int64
+	offset int64
+
+	lock   sync.Mutex
+	blocks map[int64][]byte
+	lru    []int64 // Block numbers, most recently used last
+}
+
+// OpenFile opens a file for random access
+func (p *PixelAPI) OpenFile(id string) (*RemoteFile, error) {
+	info, err := p.GetFileInfo(id)
+	if err != nil {
+		return nil, err
+	}
+	return p.openRemoteFile("file/"+id, int64(info.Size)), nil
+}
+
+func (p *PixelAPI) openRemoteFile(path string, size int64) *RemoteFile {
+	return &RemoteFile{
+		p:      p,
+		path:   path,
+		size:   size,
+		blocks: make(map[int64][]byte, remoteFileCacheBlocks),
+	}
+}
+
+// Size returns the size of the file in bytes
+func (f *RemoteFile) Size() int64 { return f.size }
+
+// ReadAt implements io.ReaderAt
+func (f *RemoteFile) ReadAt(b []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	} else if off >= f.size {
+		return 0, io.EOF
+	}
+
+	var end = off + int64(len(b))
+	if end > f.size {
+		end = f.size
+		err = io.EOF
+	}
+	var want = int(end - off)
+
+	// Large reads would not benefit from the cache, so they are requested
+	// directly
+	if want >= remoteFileBlockSize {
+		body, rerr := f.p.getRange(f.path, off, int64(want))
+		if rerr != nil {
+			return 0, rerr
+		}
+		defer body.Close()
+		if n, rerr = io.ReadFull(body, b[:want]); rerr != nil {
+			return n, fmt.Errorf("range read at %d failed: %w", off, rerr)
+		}
+		return n, err
+	}
+
+	for n < want {
+		var pos = off + int64(n)
+		var block = pos / remoteFileBlockSize
+		data, rerr := f.block(block)
+		if rerr != nil {
+			return n, rerr
+		}
+		n += copy(b[n:want], data[pos-block*remoteFileBlockSize:])
+	}
+	return n, err
+}
+
+// block returns a block from the cache, or downloads it if it's not cached
+func (f *RemoteFile) block(num int64) ([]byte, error) {
+	f.lock.Lock()
+	if data, ok := f.blocks[num]; ok {
+		f.touch(num)
+		f.lock.Unlock()
+		return data, nil
+	}
+	f.lock.Unlock()
+
+	var start = num * remoteFileBlockSize
+	var data = make([]byte, min(remoteFileBlockSize, f.size-start))
+	body, err := f.p.getRange(f.path, start, int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	if _, err = io.ReadFull(body, data); err != nil {
+		return nil, fmt.Errorf("range read at %d failed: %w", start, err)
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if _, ok := f.blocks[num]; !ok && f.blocks != nil {
+		f.blocks[num] = data
+		f.lru = append(f.lru, num)
+		if len(f.lru) > remoteFileCacheBlocks {
+			delete(f.blocks, f.lru[0])
+			f.lru = f.lru[1:]
+		}
+	}
+	return data, nil
+}
+
+// touch marks a cached block as most recently used. The lock must be held
+func (f *RemoteFile) touch(num int64) {
+	for i, v := range f.lru {
+		if v == num {
+			copy(f.lru[i:], f.lru[i+1:])
+			f.lru[len(f.lru)-1] = num
+			return
+		}
+	}
+}
+
+// Read implements io.Reader
+func (f *RemoteFile) Read(b []byte) (n int, err error) {
+	n, err = f.ReadAt(b, f.offset)
+	f.offset += int64(n)
+	if n > 0 && err == io.EOF {
+		return n, nil
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker
+func (f *RemoteFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative seek position %d", offset)
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// Close releases the cached blocks. The file should not be used after closing
+func (f *RemoteFile) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.blocks, f.lru = nil, nil
+	return nil
+}
+
+// getRange requests length bytes starting at offset from a path. The API must
+// respond with a partial content response, otherwise an error is returned.
+// Don't forget to close the body!
+func (p *PixelAPI) getRange(path string, offset, length int64) (io.ReadCloser, error) {
+	resp, err := p.rawRequest("GET", path, http.Header{
+		"Range": {"bytes=" + strconv.FormatInt(offset, 10) + "-" + strconv.FormatInt(offset+length-1, 10)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("range request for '%s' returned status %s instead of partial content", path, resp.Status)
+	}
+	return resp.Body, nil
+}
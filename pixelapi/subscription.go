@@ -23,18 +23,18 @@ type Subscription struct {
 // active subscription itself, only the properties of the subscription. Like the
 // perks and cost
 type SubscriptionType struct {
-	ID                     string `json:"id"`
-	Name                   string `json:"name"`
-	Type                   string `json:"type"`
-	FileSizeLimit          int64  `json:"file_size_limit"`
-	FileExpiryDays         int64  `json:"file_expiry_days"`
-	StorageSpace           int64  `json:"storage_space"`
-	PricePerTBStorage      int64  `json:"price_per_tb_storage"`
-	PricePerTBBandwidth    int64  `json:"price_per_tb_bandwidth"`
-	MonthlyTransferCap     int64  `json:"monthly_transfer_cap"`
-	FileViewerBranding     bool   `json:"file_viewer_branding"`
-	FilesystemAccess       bool   `json:"filesystem_access"`
-	FilesystemStorageLimit int64  `json:"filesystem_storage_limit"`
+	ID                     string   `json:"id"`
+	Name                   string   `json:"name"`
+	Type                   string   `json:"type"`
+	FileSizeLimit          ByteSize `json:"file_size_limit"`
+	FileExpiryDays         int64    `json:"file_expiry_days"`
+	StorageSpace           ByteSize `json:"storage_space"`
+	PricePerTBStorage      MicroEUR `json:"price_per_tb_storage"`
+	PricePerTBBandwidth    MicroEUR `json:"price_per_tb_bandwidth"`
+	MonthlyTransferCap     ByteSize `json:"monthly_transfer_cap"`
+	FileViewerBranding     bool     `json:"file_viewer_branding"`
+	FilesystemAccess       bool     `json:"filesystem_access"`
+	FilesystemStorageLimit ByteSize `json:"filesystem_storage_limit"`
 }
 
 // GetSubscriptionID returns the subscription object identified by the given ID
@@ -50,9 +50,9 @@ func (p *PixelAPI) PostSubscriptionLink(id string) (err error) {
 }
 
 type CouponCode struct {
-	ID     string `json:"id"`
-	Credit int64  `json:"credit"`
-	Uses   int    `json:"uses"`
+	ID     string   `json:"id"`
+	Credit MicroEUR `json:"credit"`
+	Uses   int      `json:"uses"`
 }
 
 func (p *PixelAPI) GetCouponID(id string) (resp CouponCode, err error) {
@@ -66,13 +66,13 @@ func (p *PixelAPI) PostCouponRedeem(id string) (err error) {
 type Invoice struct {
 	ID             string    `json:"id"`
 	Time           time.Time `json:"time"`
-	Amount         int64     `json:"amount"`
-	VAT            int64     `json:"vat"`
+	Amount         MicroEUR  `json:"amount"`
+	VAT            MicroEUR  `json:"vat"`
 	Country        string    `json:"country"`
 	PaymentGateway string    `json:"payment_gateway"`
 	PaymentMethod  string    `json:"payment_method"`
 	Status         string    `json:"status"`
-	ProcessingFee  int64     `json:"processing_fee"`
+	ProcessingFee  MicroEUR  `json:"processing_fee"`
 }
 
 func (p *PixelAPI) GetBTCPayInvoices() (resp []Invoice, err error) {
@@ -0,0 +1,126 @@
+package pixelapi
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"  // Register GIF decoder for Thumbnail.Image
+	_ "image/jpeg" // Register JPEG decoder for Thumbnail.Image
+	_ "image/png"  // Register PNG decoder for Thumbnail.Image
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Thumbnail sizes the API can render. The width and height of a thumbnail must
+// be multiples of ThumbnailSizeStep between ThumbnailSizeStep and
+// ThumbnailMaxSize, so 16, 32, 48 and so on up to 128
+const (
+	ThumbnailSizeStep = 16
+	ThumbnailMaxSize  = 128
+)
+
+// Thumbnail is a rendered thumbnail image
+type Thumbnail struct {
+	Data        []byte
+	ContentType string
+}
+
+// Image decodes the thumbnail. PNG, JPEG and GIF thumbnails are supported
+func (t Thumbnail) Image() (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(t.Data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s thumbnail: %w", t.ContentType, err)
+	}
+	return img, nil
+}
+
+// ThumbnailCache makes GetFileThumbnail save thumbnails in a directory. When a
+// thumbnail for the same file and size is requested again it is read from the
+// directory instead of the API. The directory is created if it does not exist
+func (p PixelAPI) ThumbnailCache(dir string) PixelAPI {
+	p.thumbnailCacheDir = dir
+	return p
+}
+
+// GetFileThumbnail gets a thumbnail of a file, scaled to fit within the given
+// width and height. The width and height must be multiples of
+// ThumbnailSizeStep and cannot be larger than ThumbnailMaxSize
+func (p *PixelAPI) GetFileThumbnail(id string, width, height int) (thumb Thumbnail, err error) {
+	if !validThumbnailSize(width) || !validThumbnailSize(height) {
+		return thumb, fmt.Errorf(
+			"invalid thumbnail size %dx%d, width and height must be multiples of %d between %d and %d",
+			width, height, ThumbnailSizeStep, ThumbnailSizeStep, ThumbnailMaxSize,
+		)
+	}
+
+	var cachePath string
+	if p.thumbnailCacheDir != "" {
+		cachePath = filepath.Join(
+			p.thumbnailCacheDir,
+			url.PathEscape(id)+"_"+strconv.Itoa(width)+"x"+strconv.Itoa(height),
+		)
+		if thumb.Data, err = os.ReadFile(cachePath); err == nil {
+			thumb.ContentType = http.DetectContentType(thumb.Data)
+			return thumb, nil
+		}
+	}
+
+	resp, err := p.rawRequest(
+		"GET",
+		"file/"+id+"/thumbnail?"+url.Values{
+			"width":  {strconv.Itoa(width)},
+			"height": {strconv.Itoa(height)},
+		}.Encode(),
+		nil,
+	)
+	if err != nil {
+		return thumb, err
+	}
+	defer resp.Body.Close()
+
+	if thumb.Data, err = io.ReadAll(resp.Body); err != nil {
+		return thumb, fmt.Errorf("failed to read thumbnail: %w", err)
+	}
+	thumb.ContentType = resp.Header.Get("Content-Type")
+	if thumb.ContentType == "" {
+		thumb.ContentType = http.DetectContentType(thumb.Data)
+	}
+
+	if cachePath != "" && strings.HasPrefix(thumb.ContentType, "image/") {
+		// Failing to write the cache is not fatal, we already have the
+		// thumbnail
+		_ = writeFileAtomic(cachePath, thumb.Data)
+	}
+	return thumb, nil
+}
+
+func validThumbnailSize(size int) bool {
+	return size >= ThumbnailSizeStep && size <= ThumbnailMaxSize && size%ThumbnailSizeStep == 0
+}
+
+// writeFileAtomic writes a file to a temporary location and then renames it to
+// the destination, so other processes never see a partially written file. The
+// parent directory is created if it does not exist
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-"+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	} else if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,330 @@
+package pixelapi
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Validate checks that the series has as many amounts as timestamps, and that
+// the timestamps are in ascending order
+func (ts TimeSeries) Validate() error {
+	if len(ts.Timestamps) != len(ts.Amounts) {
+		return fmt.Errorf(
+			"time series has %d timestamps but %d amounts",
+			len(ts.Timestamps), len(ts.Amounts),
+		)
+	}
+	for i := 1; i < len(ts.Timestamps); i++ {
+		if !ts.Timestamps[i].After(ts.Timestamps[i-1]) {
+			return fmt.Errorf("time series timestamp %d is not after timestamp %d", i, i-1)
+		}
+	}
+	return nil
+}
+
+// Interval returns the time between two data points. The smallest gap in the
+// series is used, so missing data points don't influence the result. A series
+// with less than two data points has no interval
+func (ts TimeSeries) Interval() (interval time.Duration, err error) {
+	if err = ts.Validate(); err != nil {
+		return 0, err
+	} else if len(ts.Timestamps) < 2 {
+		return 0, fmt.Errorf("time series needs at least two data points to determine the interval")
+	}
+	for i := 1; i < len(ts.Timestamps); i++ {
+		if gap := ts.Timestamps[i].Sub(ts.Timestamps[i-1]); interval == 0 || gap < interval {
+			interval = gap
+		}
+	}
+	return interval, nil
+}
+
+// Sum returns the sum of all the amounts in the series
+func (ts TimeSeries) Sum() (sum int64, err error) {
+	if err = ts.Validate(); err != nil {
+		return 0, err
+	}
+	var ok bool
+	for _, v := range ts.Amounts {
+		if sum, ok = addInt64(sum, int64(v)); !ok {
+			return 0, fmt.Errorf("time series sum: %w", ErrOverflow)
+		}
+	}
+	return sum, nil
+}
+
+// Rate returns the average amount per period over the whole series. The series
+// is assumed to span from the first timestamp to one interval past the last
+// timestamp. For example Rate(time.Hour) on a downloads series returns the
+// average number of downloads per hour
+func (ts TimeSeries) Rate(per time.Duration) (float64, error) {
+	if per <= 0 {
+		return 0, fmt.Errorf("rate period must be positive, got %s", per)
+	}
+	sum, err := ts.Sum()
+	if err != nil {
+		return 0, err
+	}
+	interval, err := ts.Interval()
+	if err != nil {
+		return 0, err
+	}
+	var span = ts.Timestamps[len(ts.Timestamps)-1].Sub(ts.Timestamps[0]) + interval
+	return float64(sum) / float64(span) * float64(per), nil
+}
+
+// MovingAverage returns the trailing average over window data points for every
+// data point in the series. The first window-1 averages are taken over the data
+// points which are available at that position
+func (ts TimeSeries) MovingAverage(window int) ([]float64, error) {
+	if err := ts.Validate(); err != nil {
+		return nil, err
+	} else if window < 1 {
+		return nil, fmt.Errorf("moving average window must be at least 1, got %d", window)
+	}
+
+	var avg = make([]float64, len(ts.Amounts))
+	var sum float64
+	for i, v := range ts.Amounts {
+		sum += float64(v)
+		if i >= window {
+			sum -= float64(ts.Amounts[i-window])
+		}
+		avg[i] = sum / float64(min(i+1, window))
+	}
+	return avg, nil
+}
+
+// Resample sums the data points into buckets of a coarser interval. Buckets
+// are aligned to the interval in UTC, so resampling to 24 hours produces one
+// data point per UTC day. Buckets without any data points are not included.
+// The interval must be a multiple of the interval of the series
+func (ts TimeSeries) Resample(interval time.Duration) (out TimeSeries, err error) {
+	if err = ts.Validate(); err != nil {
+		return out, err
+	} else if interval <= 0 {
+		return out, fmt.Errorf("resample interval must be positive, got %s", interval)
+	}
+	if len(ts.Timestamps) >= 2 {
+		current, err := ts.Interval()
+		if err != nil {
+			return out, err
+		} else if interval < current || interval%current != 0 {
+			return out, fmt.Errorf(
+				"resample interval %s is not a multiple of the series interval %s",
+				interval, current,
+			)
+		}
+	}
+
+	for i, t := range ts.Timestamps {
+		var bucket = t.UTC().Truncate(interval)
+		var last = len(out.Timestamps) - 1
+		if last >= 0 && out.Timestamps[last].Equal(bucket) {
+			sum, ok := addInt64(int64(out.Amounts[last]), int64(ts.Amounts[i]))
+			if !ok || int64(int(sum)) != sum {
+				return out, fmt.Errorf("time series resample: %w", ErrOverflow)
+			}
+			out.Amounts[last] = int(sum)
+		} else {
+			out.Timestamps = append(out.Timestamps, bucket)
+			out.Amounts = append(out.Amounts, ts.Amounts[i])
+		}
+	}
+	return out, nil
+}
+
+// Percentile returns the p-th percentile (0 to 100) of the amounts in the
+// series. Values between two data points are linearly interpolated
+func (ts TimeSeries) Percentile(p float64) (float64, error) {
+	if err := ts.Validate(); err != nil {
+		return 0, err
+	} else if p < 0 || p > 100 || math.IsNaN(p) {
+		return 0, fmt.Errorf("percentile must be between 0 and 100, got %f", p)
+	} else if len(ts.Amounts) == 0 {
+		return 0, fmt.Errorf("cannot take percentile of an empty time series")
+	}
+
+	var sorted = make([]int, len(ts.Amounts))
+	copy(sorted, ts.Amounts)
+	sort.Ints(sorted)
+
+	var rank = p / 100 * float64(len(sorted)-1)
+	var lower = int(math.Floor(rank))
+	if lower == len(sorted)-1 {
+		return float64(sorted[lower]), nil
+	}
+	var frac = rank - float64(lower)
+	return float64(sorted[lower]) + frac*float64(sorted[lower+1]-sorted[lower]), nil
+}
+
+// WriteCSV writes the series as CSV with a timestamp and amount column
+func (ts TimeSeries) WriteCSV(w io.Writer) error {
+	aligned, err := AlignTimeSeries([]string{"amount"}, ts)
+	if err != nil {
+		return err
+	}
+	return aligned.WriteCSV(w)
+}
+
+// WriteJSONLines writes one JSON object per data point, with a timestamp and
+// amount field
+func (ts TimeSeries) WriteJSONLines(w io.Writer) error {
+	aligned, err := AlignTimeSeries([]string{"amount"}, ts)
+	if err != nil {
+		return err
+	}
+	return aligned.WriteJSONLines(w)
+}
+
+// AlignedTimeSeries is a set of named time series which share the same
+// timestamps. Amounts[i] contains the values of the series named Names[i]
+type AlignedTimeSeries struct {
+	Timestamps []time.Time
+	Names      []string
+	Amounts    [][]int
+}
+
+// AlignTimeSeries aligns time series to the union of their timestamps. Data
+// points which are missing from a series are filled with zero. There must be a
+// name for every series
+func AlignTimeSeries(names []string, series ...TimeSeries) (out AlignedTimeSeries, err error) {
+	if len(names) != len(series) {
+		return out, fmt.Errorf("got %d names for %d time series", len(names), len(series))
+	}
+
+	var index = make(map[int64]int)
+	for i, ts := range series {
+		if err = ts.Validate(); err != nil {
+			return out, fmt.Errorf("time series %q: %w", names[i], err)
+		}
+		for _, t := range ts.Timestamps {
+			if _, ok := index[t.UnixNano()]; !ok {
+				index[t.UnixNano()] = 0
+				out.Timestamps = append(out.Timestamps, t)
+			}
+		}
+	}
+	sort.Slice(out.Timestamps, func(i, j int) bool { return out.Timestamps[i].Before(out.Timestamps[j]) })
+	for i, t := range out.Timestamps {
+		index[t.UnixNano()] = i
+	}
+
+	out.Names = names
+	out.Amounts = make([][]int, len(series))
+	for i, ts := range series {
+		out.Amounts[i] = make([]int, len(out.Timestamps))
+		for j, t := range ts.Timestamps {
+			out.Amounts[i][index[t.UnixNano()]] = ts.Amounts[j]
+		}
+	}
+	return out, nil
+}
+
+// MergeTimeSeries aligns the series and adds them together. ErrOverflow is
+// returned if a sum does not fit in an int
+func MergeTimeSeries(series ...TimeSeries) (out TimeSeries, err error) {
+	aligned, err := AlignTimeSeries(make([]string, len(series)), series...)
+	if err != nil {
+		return out, err
+	}
+
+	out.Timestamps = aligned.Timestamps
+	out.Amounts = make([]int, len(aligned.Timestamps))
+	for _, amounts := range aligned.Amounts {
+		for i, v := range amounts {
+			sum, ok := addInt64(int64(out.Amounts[i]), int64(v))
+			if !ok || int64(int(sum)) != sum {
+				return out, fmt.Errorf("time series merge: %w", ErrOverflow)
+			}
+			out.Amounts[i] = int(sum)
+		}
+	}
+	return out, nil
+}
+
+// Series returns the aligned series with the given name
+func (a AlignedTimeSeries) Series(name string) (ts TimeSeries, ok bool) {
+	for i := range a.Names {
+		if a.Names[i] == name {
+			return TimeSeries{Timestamps: a.Timestamps, Amounts: a.Amounts[i]}, true
+		}
+	}
+	return ts, false
+}
+
+// WriteCSV writes the series as CSV. The first column contains the RFC 3339
+// timestamps and the other columns contain the series, with the names in the
+// header row
+func (a AlignedTimeSeries) WriteCSV(w io.Writer) error {
+	var cw = csv.NewWriter(w)
+	var record = make([]string, len(a.Names)+1)
+
+	record[0] = "timestamp"
+	copy(record[1:], a.Names)
+	if err := cw.Write(record); err != nil {
+		return err
+	}
+
+	for i, t := range a.Timestamps {
+		record[0] = t.Format(time.RFC3339)
+		for j := range a.Amounts {
+			record[j+1] = strconv.Itoa(a.Amounts[j][i])
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSONLines writes one JSON object per timestamp. Every object has a
+// timestamp field and a field for each series. The series names must be unique
+// and can't be "timestamp"
+func (a AlignedTimeSeries) WriteJSONLines(w io.Writer) error {
+	var seen = make(map[string]bool, len(a.Names))
+	for _, name := range a.Names {
+		if name == "timestamp" {
+			return fmt.Errorf("time series name %q collides with the timestamp field", name)
+		} else if seen[name] {
+			return fmt.Errorf("time series name %q is used more than once", name)
+		}
+		seen[name] = true
+	}
+
+	var enc = json.NewEncoder(w)
+	var line = make(map[string]any, len(a.Names)+1)
+	for i, t := range a.Timestamps {
+		line["timestamp"] = t
+		for j, name := range a.Names {
+			line[name] = a.Amounts[j][i]
+		}
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Align aligns all the series in the file time series
+func (f FileTimeSeries) Align() (AlignedTimeSeries, error) {
+	return AlignTimeSeries(
+		[]string{"views", "downloads", "bandwidth", "bandwidth_paid"},
+		f.Views, f.Downloads, f.Bandwidth, f.BandwidthPaid,
+	)
+}
+
+// Align aligns all the series in the filesystem time series
+func (f FilesystemTimeSeries) Align() (AlignedTimeSeries, error) {
+	return AlignTimeSeries(
+		[]string{"downloads", "transfer_free", "transfer_paid"},
+		f.Downloads, f.TransferFree, f.TransferPaid,
+	)
+}
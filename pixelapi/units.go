@@ -0,0 +1,370 @@
+package pixelapi
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ErrOverflow is returned when the result of an operation on a ByteSize or
+// Money value does not fit in 64 bits
+var ErrOverflow = errors.New("integer overflow")
+
+// ByteSize is an amount of bytes. It is encoded in JSON as a plain integer, so
+// it can be used in place of the integer types the API uses for sizes
+type ByteSize int64
+
+// Decimal (SI) and binary (IEC) size units
+const (
+	Byte ByteSize = 1
+
+	KB ByteSize = 1e3
+	MB ByteSize = 1e6
+	GB ByteSize = 1e9
+	TB ByteSize = 1e12
+	PB ByteSize = 1e15
+	EB ByteSize = 1e18
+
+	KiB ByteSize = 1 << 10
+	MiB ByteSize = 1 << 20
+	GiB ByteSize = 1 << 30
+	TiB ByteSize = 1 << 40
+	PiB ByteSize = 1 << 50
+	EiB ByteSize = 1 << 60
+)
+
+var (
+	siUnits  = []string{"B", "kB", "MB", "GB", "TB", "PB", "EB"}
+	iecUnits = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+	// Lowercased unit names accepted by ParseByteSize
+	byteSizeUnits = map[string]ByteSize{
+		"": Byte, "b": Byte, "byte": Byte, "bytes": Byte,
+		"k": KB, "kb": KB, "m": MB, "mb": MB, "g": GB, "gb": GB,
+		"t": TB, "tb": TB, "p": PB, "pb": PB, "e": EB, "eb": EB,
+		"kib": KiB, "mib": MiB, "gib": GiB, "tib": TiB, "pib": PiB, "eib": EiB,
+	}
+)
+
+// String formats the size with decimal units, like pixeldrain does. For example
+// "1.50 GB"
+func (b ByteSize) String() string { return b.FormatSI(2) }
+
+// FormatSI formats the size with decimal units (kB, MB, GB, ...) and the given
+// number of decimals
+func (b ByteSize) FormatSI(decimals int) string { return b.format(1000, siUnits, decimals) }
+
+// FormatIEC formats the size with binary units (KiB, MiB, GiB, ...) and the
+// given number of decimals
+func (b ByteSize) FormatIEC(decimals int) string { return b.format(1024, iecUnits, decimals) }
+
+func (b ByteSize) format(base float64, units []string, decimals int) string {
+	// Work with floats so math.MinInt64 does not overflow when negated. The
+	// value is only used for display so the precision loss is acceptable
+	var v = math.Abs(float64(b))
+	var sign = ""
+	if b < 0 {
+		sign = "-"
+	}
+	if v < base {
+		return sign + strconv.FormatInt(int64(v), 10) + " " + units[0]
+	}
+
+	var unit = 0
+	for v >= base && unit < len(units)-1 {
+		v /= base
+		unit++
+	}
+	// Rounding can push the value up to the next unit, 999999 bytes would be
+	// "1000.00 kB" instead of "1.00 MB"
+	if decimals >= 0 && unit < len(units)-1 {
+		var scale = math.Pow10(decimals)
+		if math.Round(v*scale)/scale >= base {
+			v /= base
+			unit++
+		}
+	}
+	return sign + strconv.FormatFloat(v, 'f', decimals, 64) + " " + units[unit]
+}
+
+// Add returns the sum of two sizes. ErrOverflow is returned if the result does
+// not fit in a ByteSize
+func (b ByteSize) Add(o ByteSize) (ByteSize, error) {
+	sum, ok := addInt64(int64(b), int64(o))
+	if !ok {
+		return 0, fmt.Errorf("%d + %d: %w", b, o, ErrOverflow)
+	}
+	return ByteSize(sum), nil
+}
+
+// Mul returns the size multiplied by n. ErrOverflow is returned if the result
+// does not fit in a ByteSize
+func (b ByteSize) Mul(n int64) (ByteSize, error) {
+	prod, ok := mulInt64(int64(b), n)
+	if !ok {
+		return 0, fmt.Errorf("%d * %d: %w", b, n, ErrOverflow)
+	}
+	return ByteSize(prod), nil
+}
+
+// ParseByteSize parses a human readable size like "512", "1.5 GB" or "10GiB".
+// Units are case-insensitive, a unit without an i (like "MB") is decimal and a
+// unit with an i (like "MiB") is binary. Fractional sizes are rounded to the
+// nearest byte. Negative sizes are not accepted
+func ParseByteSize(s string) (ByteSize, error) {
+	s = strings.TrimSpace(s)
+	var split = strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.' && r != '-' && r != '+'
+	})
+	if split == -1 {
+		split = len(s)
+	}
+
+	num, unitName := s[:split], strings.ToLower(strings.TrimSpace(s[split:]))
+	unit, ok := byteSizeUnits[unitName]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit %q", s, unitName)
+	}
+
+	// Parse the number as a rational so that sizes like "1.1 TB" are exact
+	r, ok := new(big.Rat).SetString(num)
+	if !ok || num == "" {
+		return 0, fmt.Errorf("invalid size %q: malformed number", s)
+	} else if r.Sign() < 0 {
+		return 0, fmt.Errorf("invalid size %q: size is negative", s)
+	}
+	r.Mul(r, new(big.Rat).SetInt64(int64(unit)))
+
+	// Round half away from zero
+	var q, m = new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if new(big.Int).Lsh(new(big.Int).Abs(m), 1).Cmp(r.Denom()) >= 0 {
+		q.Add(q, big.NewInt(int64(m.Sign())))
+	}
+	if !q.IsInt64() {
+		return 0, fmt.Errorf("invalid size %q: %w", s, ErrOverflow)
+	}
+	return ByteSize(q.Int64()), nil
+}
+
+// Currency is an ISO 4217 currency code
+type Currency string
+
+// Currencies used by the pixeldrain API
+const (
+	EUR Currency = "EUR"
+)
+
+var currencySymbols = map[Currency]string{EUR: "€"}
+
+// MoneyUnit is the number of units which make up one whole currency unit. A
+// MoneyUnit of 100 means the amount is in cents
+type MoneyUnit int64
+
+// Money units used by the pixeldrain API
+const (
+	UnitWhole MoneyUnit = 1
+	UnitCents MoneyUnit = 100
+	UnitMicro MoneyUnit = 1e6
+)
+
+// decimals returns the number of decimals needed to display an amount in this
+// unit without losing precision. Units which are not a power of ten are
+// rounded up
+func (u MoneyUnit) decimals() (d int) {
+	for v := int64(1); v < int64(u); v *= 10 {
+		d++
+	}
+	return d
+}
+
+// Money is an exact amount of money. Amount is expressed in Unit, so an Amount
+// of 150 with Unit UnitCents is one and a half of the Currency
+type Money struct {
+	Amount   int64
+	Unit     MoneyUnit
+	Currency Currency
+}
+
+// String formats the amount exactly, with as many decimals as the unit
+// requires. For example "€1.50" or "-€0.000250"
+func (m Money) String() string { return m.Format(m.Unit.decimals()) }
+
+// Format formats the amount with the currency symbol and the given number of
+// decimals. If the unit has more precision than that the amount is rounded half
+// away from zero
+func (m Money) Format(decimals int) string {
+	if m.Unit <= 0 {
+		return fmt.Sprintf("%d %s (invalid unit %d)", m.Amount, m.Currency, m.Unit)
+	}
+
+	var r = new(big.Rat).SetFrac(big.NewInt(m.Amount), big.NewInt(int64(m.Unit)))
+	var sign = ""
+	if r.Sign() < 0 {
+		sign = "-"
+		r.Neg(r)
+	}
+	var num = r.FloatString(decimals)
+
+	if sym, ok := currencySymbols[m.Currency]; ok {
+		return sign + sym + num
+	}
+	return sign + num + " " + string(m.Currency)
+}
+
+// Convert expresses the amount in a different unit. An error is returned if the
+// conversion would lose precision or overflow
+func (m Money) Convert(unit MoneyUnit) (Money, error) {
+	if m.Unit <= 0 || unit <= 0 {
+		return Money{}, fmt.Errorf("invalid money unit %d or %d", m.Unit, unit)
+	}
+
+	var out = Money{Unit: unit, Currency: m.Currency}
+	if unit >= m.Unit {
+		if unit%m.Unit != 0 {
+			return Money{}, fmt.Errorf("cannot convert unit %d to %d exactly", m.Unit, unit)
+		}
+		amount, ok := mulInt64(m.Amount, int64(unit/m.Unit))
+		if !ok {
+			return Money{}, fmt.Errorf("convert %s to unit %d: %w", m, unit, ErrOverflow)
+		}
+		out.Amount = amount
+	} else {
+		if m.Unit%unit != 0 || m.Amount%int64(m.Unit/unit) != 0 {
+			return Money{}, fmt.Errorf("cannot convert %s to unit %d without losing precision", m, unit)
+		}
+		out.Amount = m.Amount / int64(m.Unit/unit)
+	}
+	return out, nil
+}
+
+// common converts both amounts to the most precise of their units so they can
+// be compared or added
+func (m Money) common(o Money) (Money, Money, error) {
+	if m.Currency != o.Currency {
+		return m, o, fmt.Errorf("currency mismatch: %s and %s", m.Currency, o.Currency)
+	}
+	var err error
+	if o.Unit > m.Unit {
+		m, err = m.Convert(o.Unit)
+	} else if m.Unit > o.Unit {
+		o, err = o.Convert(m.Unit)
+	}
+	return m, o, err
+}
+
+// Add returns the sum of two amounts. The amounts must have the same currency,
+// the result is expressed in the most precise unit of the two
+func (m Money) Add(o Money) (Money, error) {
+	m, o, err := m.common(o)
+	if err != nil {
+		return Money{}, err
+	}
+	sum, ok := addInt64(m.Amount, o.Amount)
+	if !ok {
+		return Money{}, fmt.Errorf("%s + %s: %w", m, o, ErrOverflow)
+	}
+	m.Amount = sum
+	return m, nil
+}
+
+// Sub returns the difference between two amounts. The amounts must have the
+// same currency, the result is expressed in the most precise unit of the two
+func (m Money) Sub(o Money) (Money, error) {
+	if o.Amount == math.MinInt64 {
+		return Money{}, fmt.Errorf("%s - %s: %w", m, o, ErrOverflow)
+	}
+	o.Amount = -o.Amount
+	return m.Add(o)
+}
+
+// Mul returns the amount multiplied by n
+func (m Money) Mul(n int64) (Money, error) {
+	prod, ok := mulInt64(m.Amount, n)
+	if !ok {
+		return Money{}, fmt.Errorf("%s * %d: %w", m, n, ErrOverflow)
+	}
+	m.Amount = prod
+	return m, nil
+}
+
+// Cmp compares two amounts. It returns -1 if m < o, 0 if m == o and 1 if m > o.
+// An error is returned if the currencies differ
+func (m Money) Cmp(o Money) (int, error) {
+	m, o, err := m.common(o)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case m.Amount < o.Amount:
+		return -1, nil
+	case m.Amount > o.Amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// MicroEUR is an amount of money in millionths of a euro. This is how the API
+// encodes most amounts of money
+type MicroEUR int64
+
+// Money returns the amount as a Money value
+func (m MicroEUR) Money() Money { return Money{Amount: int64(m), Unit: UnitMicro, Currency: EUR} }
+
+// String formats the amount exactly. It has at least two decimals, and more
+// only when they are needed, like "€1.50" or "€1.234567"
+func (m MicroEUR) String() string {
+	var decimals, div = 2, int64(10000)
+	for int64(m)%div != 0 {
+		decimals, div = decimals+1, div/10
+	}
+	return m.Money().Format(decimals)
+}
+
+// CentsEUR is an amount of money in euro cents
+type CentsEUR int64
+
+// Money returns the amount as a Money value
+func (c CentsEUR) Money() Money { return Money{Amount: int64(c), Unit: UnitCents, Currency: EUR} }
+
+func (c CentsEUR) String() string { return c.Money().String() }
+
+// MicroEUR converts the amount to micro-euros. An error is returned if the
+// currency is not EUR or the conversion is not exact
+func (m Money) MicroEUR() (MicroEUR, error) {
+	if m.Currency != EUR {
+		return 0, fmt.Errorf("cannot convert %s to EUR", m.Currency)
+	}
+	c, err := m.Convert(UnitMicro)
+	return MicroEUR(c.Amount), err
+}
+
+// CentsEUR converts the amount to euro cents. An error is returned if the
+// currency is not EUR or the conversion is not exact
+func (m Money) CentsEUR() (CentsEUR, error) {
+	if m.Currency != EUR {
+		return 0, fmt.Errorf("cannot convert %s to EUR", m.Currency)
+	}
+	c, err := m.Convert(UnitCents)
+	return CentsEUR(c.Amount), err
+}
+
+func addInt64(a, b int64) (int64, bool) {
+	var sum = a + b
+	// Overflow happened if both operands have the same sign and the result's
+	// sign is different
+	return sum, (a >= 0) != (b >= 0) || (sum >= 0) == (a >= 0)
+}
+
+func mulInt64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	var prod = a * b
+	if prod/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return 0, false
+	}
+	return prod, true
+}
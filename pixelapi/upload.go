@@ -0,0 +1,161 @@
+package pixelapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UploadOptions changes the behaviour of PutFile
+type UploadOptions struct {
+	// Deduplicate makes the uploader check whether the account already
+	// contains a file with the same SHA-256 checksum. If it does, the existing
+	// file is returned instead of uploading it again
+	Deduplicate *Deduplicator
+}
+
+// PutFile uploads a file to the account which is logged in, or anonymously if
+// the client is not logged in. When deduplication is enabled the file is hashed
+// before uploading. Readers which don't implement io.Seeker are buffered in a
+// temporary file for this. If a duplicate was found the ID of the existing file
+// is returned and duplicate is true
+func (p *PixelAPI) PutFile(name string, r io.Reader, opts UploadOptions) (resp FileID, duplicate bool, err error) {
+	if name == "" {
+		return resp, false, fmt.Errorf("file name cannot be empty")
+	}
+
+	if opts.Deduplicate == nil {
+		return resp, false, p.bodyRequest("PUT", "file/"+url.PathEscape(name), "application/octet-stream", r, &resp)
+	}
+
+	body, sum, cleanup, err := hashUpload(r)
+	if err != nil {
+		return resp, false, err
+	}
+	defer cleanup()
+
+	info, ok, err := opts.Deduplicate.UserFile(p, sum)
+	if err != nil {
+		return resp, false, fmt.Errorf("failed to check for duplicate files: %w", err)
+	} else if ok {
+		return FileID{ID: info.ID}, true, nil
+	}
+
+	if err = p.bodyRequest("PUT", "file/"+url.PathEscape(name), "application/octet-stream", body, &resp); err != nil {
+		return resp, false, err
+	}
+	opts.Deduplicate.add(FileInfo{ID: resp.ID, Name: name, HashSHA256: sum})
+	return resp, false, nil
+}
+
+// hashUpload calculates the SHA-256 checksum of an upload and returns a reader
+// positioned at the start of the data. If the reader is not seekable the data
+// is copied to a temporary file while hashing. The cleanup function removes
+// the temporary file
+func hashUpload(r io.Reader) (body io.Reader, sum string, cleanup func(), err error) {
+	var hasher = sha256.New()
+	cleanup = func() {}
+
+	if rs, ok := r.(io.ReadSeeker); ok {
+		start, err := rs.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, "", cleanup, fmt.Errorf("failed to seek upload: %w", err)
+		}
+		if _, err = io.Copy(hasher, rs); err != nil {
+			return nil, "", cleanup, fmt.Errorf("failed to hash upload: %w", err)
+		}
+		if _, err = rs.Seek(start, io.SeekStart); err != nil {
+			return nil, "", cleanup, fmt.Errorf("failed to seek upload: %w", err)
+		}
+		return rs, hex.EncodeToString(hasher.Sum(nil)), cleanup, nil
+	}
+
+	tmp, err := os.CreateTemp("", "pixeldrain-upload-*")
+	if err != nil {
+		return nil, "", cleanup, fmt.Errorf("failed to create temporary upload file: %w", err)
+	}
+	cleanup = func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+	if _, err = io.Copy(io.MultiWriter(tmp, hasher), r); err != nil {
+		cleanup()
+		return nil, "", func() {}, fmt.Errorf("failed to buffer upload: %w", err)
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, "", func() {}, fmt.Errorf("failed to seek upload: %w", err)
+	}
+	return tmp, hex.EncodeToString(hasher.Sum(nil)), cleanup, nil
+}
+
+// Deduplicator keeps track of the checksums of the files in a user account.
+// The file list is requested with GetUserFiles and cached for a while, files
+// uploaded through the deduplicator are added to the cache. A Deduplicator is
+// safe for concurrent use
+type Deduplicator struct {
+	ttl     time.Duration
+	lock    sync.Mutex
+	files   map[string]FileInfo // By lowercase SHA-256 checksum
+	fetched time.Time
+}
+
+// NewDeduplicator creates a deduplicator which refreshes the user's file list
+// when it's older than ttl
+func NewDeduplicator(ttl time.Duration) *Deduplicator {
+	return &Deduplicator{ttl: ttl}
+}
+
+// UserFile looks up a file with the given SHA-256 checksum in the account of
+// the user who is logged in to the API client
+func (d *Deduplicator) UserFile(p *PixelAPI, sum string) (info FileInfo, ok bool, err error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.files == nil || time.Since(d.fetched) > d.ttl {
+		files, err := p.GetUserFiles()
+		if err != nil {
+			return info, false, err
+		}
+		d.files = make(map[string]FileInfo, len(files.Files))
+		for _, f := range files.Files {
+			if f.HashSHA256 != "" {
+				d.files[strings.ToLower(f.HashSHA256)] = f
+			}
+		}
+		d.fetched = time.Now()
+	}
+
+	info, ok = d.files[strings.ToLower(sum)]
+	return info, ok, nil
+}
+
+// add registers a newly uploaded file
+func (d *Deduplicator) add(info FileInfo) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.files != nil {
+		d.files[strings.ToLower(info.HashSHA256)] = info
+	}
+}
+
+// FindFilesystemDuplicate looks for a file with the given SHA-256 checksum in a
+// filesystem directory. Only the direct children of the directory are checked
+func (p *PixelAPI) FindFilesystemDuplicate(dir, sum string) (node FilesystemNode, ok bool, err error) {
+	fsp, err := p.GetFilesystemPath(dir)
+	if err != nil {
+		return node, false, err
+	}
+	for _, child := range fsp.Children {
+		if child.Type == "file" && strings.EqualFold(child.SHA256Sum, sum) {
+			return child, true, nil
+		}
+	}
+	return node, false, nil
+}
@@ -15,15 +15,15 @@ type UserInfo struct {
 	EmailVerified         bool              `json:"email_verified"`
 	OTPEnabled            bool              `json:"otp_enabled"`
 	Subscription          SubscriptionType  `json:"subscription"`
-	StorageSpaceUsed      int               `json:"storage_space_used"`
-	FilesystemStorageUsed int               `json:"filesystem_storage_used"`
+	StorageSpaceUsed      ByteSize          `json:"storage_space_used"`
+	FilesystemStorageUsed ByteSize          `json:"filesystem_storage_used"`
 	FileCount             int               `json:"file_count"`
 	FilesystemNodeCount   int               `json:"filesystem_node_count"`
 	IsAdmin               bool              `json:"is_admin"`
-	BalanceMicroEUR       int64             `json:"balance_micro_eur"`
+	BalanceMicroEUR       MicroEUR          `json:"balance_micro_eur"`
 	Hotlinking            bool              `json:"hotlinking_enabled"`
-	MonthlyTransferCap    int               `json:"monthly_transfer_cap"`
-	MonthlyTransferUsed   int               `json:"monthly_transfer_used"`
+	MonthlyTransferCap    ByteSize          `json:"monthly_transfer_cap"`
+	MonthlyTransferUsed   ByteSize          `json:"monthly_transfer_used"`
 	FileViewerBranding    map[string]string `json:"file_viewer_branding"`
 	FileEmbedDomains      string            `json:"file_embed_domains"`
 	SkipFileViewer        bool              `json:"skip_file_viewer"`
@@ -123,14 +123,14 @@ func (p *PixelAPI) GetUserLists() (resp ListInfoSlice, err error) {
 
 type UserTransaction struct {
 	Time               time.Time `json:"time"`
-	NewBalance         int64     `json:"new_balance"`
-	DepositAmount      int64     `json:"deposit_amount"`
-	SubscriptionCharge int64     `json:"subscription_charge"`
-	StorageCharge      int64     `json:"storage_charge"`
-	StorageUsed        int       `json:"storage_used"`
-	BandwidthCharge    int64     `json:"bandwidth_charge"`
-	BandwidthUsed      int       `json:"bandwidth_used"`
-	AffiliateAmount    int64     `json:"affiliate_amount"`
+	NewBalance         MicroEUR  `json:"new_balance"`
+	DepositAmount      MicroEUR  `json:"deposit_amount"`
+	SubscriptionCharge MicroEUR  `json:"subscription_charge"`
+	StorageCharge      MicroEUR  `json:"storage_charge"`
+	StorageUsed        ByteSize  `json:"storage_used"`
+	BandwidthCharge    MicroEUR  `json:"bandwidth_charge"`
+	BandwidthUsed      ByteSize  `json:"bandwidth_used"`
+	AffiliateAmount    MicroEUR  `json:"affiliate_amount"`
 	AffiliateCount     int       `json:"affiliate_count"`
 }
 
@@ -0,0 +1,74 @@
+package s3gw
+
+import (
+	"encoding/xml"
+	"errors"
+	"io/fs"
+	"net/http"
+
+	"fornaxian.tech/pixeldrain_api_client/pixelapi"
+)
+
+// s3Error is an error response in the S3 format
+type s3Error struct {
+	XMLName  xml.Name `xml:"Error"`
+	Status   int      `xml:"-"`
+	Code     string   `xml:"Code"`
+	Message  string   `xml:"Message"`
+	Resource string   `xml:"Resource,omitempty"`
+}
+
+func (e *s3Error) Error() string { return e.Code + ": " + e.Message }
+
+// withMessage returns a copy of the error with another message
+func (e *s3Error) withMessage(message string) *s3Error {
+	var c = *e
+	c.Message = message
+	return &c
+}
+
+func newError(status int, code, message string) *s3Error {
+	return &s3Error{Status: status, Code: code, Message: message}
+}
+
+// Errors from the S3 error code list
+var (
+	errAccessDenied                 = newError(http.StatusForbidden, "AccessDenied", "Access Denied")
+	errAuthorizationHeaderMalformed = newError(http.StatusBadRequest, "AuthorizationHeaderMalformed", "The authorization header is malformed")
+	errAuthorizationQueryMalformed  = newError(http.StatusBadRequest, "AuthorizationQueryParametersError", "The authorization query parameters are malformed")
+	errBadDigest                    = newError(http.StatusBadRequest, "BadDigest", "The checksum of the data does not match")
+	errContentSHA256Mismatch        = newError(http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The provided x-amz-content-sha256 header does not match what was computed")
+	errInternalError                = newError(http.StatusInternalServerError, "InternalError", "We encountered an internal error. Please try again.")
+	errInvalidAccessKeyID           = newError(http.StatusForbidden, "InvalidAccessKeyId", "The access key ID you provided does not exist in our records")
+	errInvalidArgument              = newError(http.StatusBadRequest, "InvalidArgument", "Invalid argument")
+	errInvalidContentSHA256         = newError(http.StatusBadRequest, "InvalidArgument", "The x-amz-content-sha256 header is invalid")
+	errInvalidRange                 = newError(http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable")
+	errMethodNotAllowed             = newError(http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource")
+	errMissingContentSHA256         = newError(http.StatusBadRequest, "InvalidRequest", "Missing required header for this request: x-amz-content-sha256")
+	errNoSuchBucket                 = newError(http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+	errNoSuchKey                    = newError(http.StatusNotFound, "NoSuchKey", "The specified key does not exist")
+	errNotImplemented               = newError(http.StatusNotImplemented, "NotImplemented", "A header or query you provided implies functionality that is not implemented")
+	errPreconditionFailed           = newError(http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the preconditions you specified did not hold")
+	errRequestTimeTooSkewed         = newError(http.StatusForbidden, "RequestTimeTooSkewed", "The difference between the request time and the server's time is too large")
+	errSignatureDoesNotMatch        = newError(http.StatusForbidden, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided")
+)
+
+// apiError converts an error from the pixeldrain API to an S3 error. notFound
+// is returned when the path does not exist
+func apiError(err error, notFound *s3Error) *s3Error {
+	var s3err *s3Error
+	var apierr pixelapi.Error
+	switch {
+	case errors.As(err, &s3err):
+		return s3err
+	case errors.Is(err, fs.ErrNotExist):
+		return notFound
+	case errors.Is(err, fs.ErrPermission):
+		return errAccessDenied
+	case errors.Is(err, pixelapi.ErrChecksumMismatch):
+		return errBadDigest
+	case errors.As(err, &apierr) && apierr.Status >= 400 && apierr.Status < 500:
+		return newError(apierr.Status, "InvalidRequest", apierr.Message)
+	}
+	return errInternalError
+}
@@ -0,0 +1,200 @@
+// Package s3gw serves pixeldrain filesystem buckets over a subset of the S3
+// REST API, so tools which only speak S3 can use them. Supported are
+// ListBuckets, HeadBucket, ListObjectsV2, GetObject, HeadObject, PutObject,
+// CopyObject and DeleteObject. Requests must use path-style addressing and
+// be signed with AWS Signature Version 4, either in the Authorization header
+// or as a presigned URL. Multipart uploads, versioning, ACLs and tagging are
+// not supported.
+//
+// Filesystem directories are mapped to key prefixes ending with a slash.
+// Because objects are stored as files, keys can't contain empty, "." or ".."
+// path segments.
+package s3gw
+
+import (
+	"encoding/xml"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"fornaxian.tech/pixeldrain_api_client/pixelapi"
+)
+
+// Gateway is an http.Handler which translates S3 requests to the pixeldrain
+// filesystem API. Every access key is mapped to a pixeldrain API key, requests
+// are executed as the user the API key belongs to
+type Gateway struct {
+	api         pixelapi.PixelAPI
+	credentials map[string]Credential
+
+	// Logger receives errors which are returned to the client as internal
+	// errors. Nothing is logged if it's nil
+	Logger *log.Logger
+}
+
+// New creates a Gateway. api is the client used for requests, it's logged in
+// with the API key from the credential of every request. credentials maps
+// access key IDs to credentials
+func New(api pixelapi.PixelAPI, credentials map[string]Credential) *Gateway {
+	return &Gateway{api: api, credentials: credentials}
+}
+
+// s3Namespace is the XML namespace of S3 responses
+const s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// ServeHTTP implements http.Handler
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var bucket, key, _ = strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	var err = g.serve(w, r, bucket, key)
+	if err != nil {
+		if err.Status == http.StatusInternalServerError && g.Logger != nil {
+			g.Logger.Printf("%s %s: %s", r.Method, r.URL.Path, err)
+		}
+		var resp = *err
+		resp.Resource = r.URL.Path
+		if r.Method == http.MethodHead {
+			w.WriteHeader(resp.Status)
+			return
+		}
+		writeXML(w, resp.Status, resp)
+	}
+}
+
+func (g *Gateway) serve(w http.ResponseWriter, r *http.Request, bucket, key string) *s3Error {
+	api, body, err := g.authenticate(r)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case bucket == "" && r.Method == http.MethodGet:
+		return listBuckets(w, api)
+	case bucket == "":
+		return errMethodNotAllowed
+	case key == "" && r.Method == http.MethodHead:
+		return headBucket(w, api, bucket)
+	case key == "" && r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		return listObjects(w, r, api, bucket)
+	case key == "":
+		return errNotImplemented
+	}
+
+	// Object operations don't support sub-resources like ?acl or ?uploads.
+	// Parameters which only carry information are ignored
+	for param := range r.URL.Query() {
+		if !strings.HasPrefix(param, "X-Amz-") && !strings.HasPrefix(param, "response-") && param != "x-id" {
+			return errNotImplemented
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return getObject(w, r, api, bucket, key)
+	case http.MethodPut:
+		if r.Header.Get("X-Amz-Copy-Source") != "" {
+			return copyObject(w, r, api, bucket, key)
+		}
+		return putObject(w, r, api, body, bucket, key)
+	case http.MethodDelete:
+		return deleteObject(w, api, bucket, key)
+	}
+	return errMethodNotAllowed
+}
+
+// authenticate verifies the signature of a request. It returns an API client
+// logged in as the owner of the access key and the verified request body
+func (g *Gateway) authenticate(r *http.Request) (api *pixelapi.PixelAPI, body io.Reader, err *s3Error) {
+	sig, err := parseSigV4(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	cred, ok := g.credentials[sig.accessKey]
+	if !ok {
+		return nil, nil, errInvalidAccessKeyID
+	}
+	key, err := sig.verify(r, cred.SecretKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if body, err = sig.payloadReader(r, key); err != nil {
+		return nil, nil, err
+	}
+
+	var client = g.api.Login(cred.APIKey)
+	return &client, body, nil
+}
+
+// objectPath returns the filesystem path of a key in a bucket
+func objectPath(bucket, key string) (pixelapi.FSPath, *s3Error) {
+	fsp, err := pixelapi.ParseFSPath("/" + bucket + "/" + key)
+	if err != nil {
+		return fsp, errInvalidArgument.withMessage(err.Error())
+	}
+	return fsp, nil
+}
+
+// etag returns the ETag of a node. S3 ETags are usually MD5 checksums, but the
+// API only has SHA-256 checksums. The full checksum is used so clients don't
+// mistake it for an MD5 checksum
+func etag(node pixelapi.FilesystemNode) string {
+	return `"` + node.SHA256Sum + `"`
+}
+
+func writeXML(w http.ResponseWriter, status int, v any) *s3Error {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return errInternalError
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+	return nil
+}
+
+type listBucketsResult struct {
+	XMLName xml.Name `xml:"ListAllMyBucketsResult"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Owner   owner    `xml:"Owner"`
+	Buckets []bucket `xml:"Buckets>Bucket"`
+}
+
+type owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+type bucket struct {
+	Name         string    `xml:"Name"`
+	CreationDate time.Time `xml:"CreationDate"`
+}
+
+func listBuckets(w http.ResponseWriter, api *pixelapi.PixelAPI) *s3Error {
+	buckets, err := api.GetFilesystems()
+	if err != nil {
+		return apiError(err, errNoSuchBucket)
+	}
+	var resp = listBucketsResult{Xmlns: s3Namespace, Buckets: []bucket{}}
+	for _, b := range buckets {
+		resp.Buckets = append(resp.Buckets, bucket{Name: b.Name, CreationDate: b.Created.UTC()})
+		if resp.Owner.ID == "" {
+			resp.Owner = owner{ID: b.CreatedBy, DisplayName: b.CreatedBy}
+		}
+	}
+	return writeXML(w, http.StatusOK, resp)
+}
+
+func headBucket(w http.ResponseWriter, api *pixelapi.PixelAPI, bucket string) *s3Error {
+	fsp, serr := objectPath(bucket, "")
+	if serr != nil {
+		return serr
+	}
+	if _, err := api.StatFilesystemPath(fsp.String()); err != nil {
+		return apiError(err, errNoSuchBucket)
+	}
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
@@ -0,0 +1,196 @@
+package s3gw
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"fornaxian.tech/pixeldrain_api_client/pixelapi"
+)
+
+const maxListKeys = 1000
+
+type listObjectsResult struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Xmlns                 string         `xml:"xmlns,attr"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	KeyCount              int            `xml:"KeyCount"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	EncodingType          string         `xml:"EncodingType,omitempty"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	Contents              []object       `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+type object struct {
+	Key          string    `xml:"Key"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+	Size         int64     `xml:"Size"`
+	StorageClass string    `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// listEntry is an object or a common prefix in a listing
+type listEntry struct {
+	key    string
+	node   pixelapi.FilesystemNode
+	prefix bool
+}
+
+func listObjects(w http.ResponseWriter, r *http.Request, api *pixelapi.PixelAPI, bucket string) *s3Error {
+	var q = r.URL.Query()
+	var resp = listObjectsResult{
+		Xmlns:             s3Namespace,
+		Name:              bucket,
+		Prefix:            q.Get("prefix"),
+		Delimiter:         q.Get("delimiter"),
+		MaxKeys:           maxListKeys,
+		ContinuationToken: q.Get("continuation-token"),
+		StartAfter:        q.Get("start-after"),
+		EncodingType:      q.Get("encoding-type"),
+	}
+	if resp.EncodingType != "" && resp.EncodingType != "url" {
+		return errInvalidArgument.withMessage("Invalid encoding type")
+	}
+	if maxKeys := q.Get("max-keys"); maxKeys != "" {
+		n, err := strconv.Atoi(maxKeys)
+		if err != nil || n < 0 {
+			return errInvalidArgument.withMessage("Invalid max-keys")
+		}
+		resp.MaxKeys = min(n, maxListKeys)
+	}
+
+	var after = resp.StartAfter
+	if resp.ContinuationToken != "" {
+		token, err := base64.RawURLEncoding.DecodeString(resp.ContinuationToken)
+		if err != nil {
+			return errInvalidArgument.withMessage("The continuation token provided is incorrect")
+		}
+		after = max(after, string(token))
+	}
+
+	entries, serr := listEntries(api, bucket, resp.Prefix, resp.Delimiter)
+	if serr != nil {
+		return serr
+	}
+
+	var start = sort.Search(len(entries), func(i int) bool { return entries[i].key > after })
+	entries = entries[start:]
+	if len(entries) > resp.MaxKeys {
+		entries = entries[:resp.MaxKeys]
+		resp.IsTruncated = true
+		resp.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(entries[len(entries)-1].key))
+	}
+	resp.KeyCount = len(entries)
+
+	var encode = func(s string) string { return s }
+	if resp.EncodingType == "url" {
+		encode = func(s string) string { return uriEncode(s, false) }
+		resp.Prefix, resp.Delimiter, resp.StartAfter = encode(resp.Prefix), encode(resp.Delimiter), encode(resp.StartAfter)
+	}
+	for _, e := range entries {
+		if e.prefix {
+			resp.CommonPrefixes = append(resp.CommonPrefixes, commonPrefix{Prefix: encode(e.key)})
+			continue
+		}
+		resp.Contents = append(resp.Contents, object{
+			Key:          encode(e.key),
+			LastModified: e.node.Modified.UTC(),
+			ETag:         etag(e.node),
+			Size:         int64(e.node.FileSize),
+			StorageClass: "STANDARD",
+		})
+	}
+	return writeXML(w, http.StatusOK, resp)
+}
+
+// listEntries returns all objects and common prefixes matching a prefix,
+// sorted by key. Only the deepest directory which contains all matching keys
+// is walked. When the delimiter is a slash directories are returned as common
+// prefixes without walking them
+func listEntries(api *pixelapi.PixelAPI, bucket, prefix, delimiter string) ([]listEntry, *s3Error) {
+	var base = prefix[:strings.LastIndex(prefix, "/")+1]
+	root, serr := objectPath(bucket, base)
+	if serr != nil {
+		// A prefix which is not a valid path can't match any files
+		return nil, nil
+	}
+
+	var entries []listEntry
+	var prefixes = make(map[string]bool)
+	var add = func(key string, node pixelapi.FilesystemNode) {
+		if !strings.HasPrefix(key, prefix) {
+			return
+		}
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				var p = key[:len(prefix)+i+len(delimiter)]
+				if !prefixes[p] {
+					prefixes[p] = true
+					entries = append(entries, listEntry{key: p, prefix: true})
+				}
+				return
+			}
+		}
+		entries = append(entries, listEntry{key: key, node: node})
+	}
+
+	var opts pixelapi.FilesystemWalkOptions
+	if delimiter == "/" {
+		opts.MaxDepth = 1
+	}
+	err := api.WalkFilesystem(root.String(), func(p string, node pixelapi.FilesystemNode, err error) error {
+		if p == root.String() {
+			if errors.Is(err, fs.ErrNotExist) && base != "" {
+				if _, err = api.StatFilesystemPath("/" + bucket); err != nil {
+					return apiError(err, errNoSuchBucket)
+				}
+				return nil
+			} else if err != nil {
+				return apiError(err, errNoSuchBucket)
+			} else if !node.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		} else if errors.Is(err, fs.ErrNotExist) {
+			return nil // Removed while we were listing
+		} else if err != nil {
+			return apiError(err, errNoSuchBucket)
+		}
+
+		var key = base + strings.TrimPrefix(p, root.String()+"/")
+		if !node.IsDir() {
+			add(key, node)
+			return nil
+		}
+		key += "/"
+		if delimiter == "/" && strings.HasPrefix(key, prefix) {
+			add(key, node)
+			return fs.SkipDir
+		} else if strings.HasPrefix(key, prefix) || strings.HasPrefix(prefix, key) {
+			return nil
+		}
+		return fs.SkipDir
+	}, opts)
+	if err != nil {
+		return nil, apiError(err, errNoSuchBucket)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+	return entries, nil
+}
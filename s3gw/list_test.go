@@ -0,0 +1,268 @@
+package s3gw
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"fornaxian.tech/pixeldrain_api_client/pixelapi"
+)
+
+// newListAPI serves the stat requests of the filesystem API for a bucket named
+// "b" containing the given files. Parent directories are created implicitly
+func newListAPI(t *testing.T, files ...string) *pixelapi.PixelAPI {
+	var nodes = map[string]pixelapi.FilesystemNode{"/b": {Type: "dir", Path: "/b", Name: "b"}}
+	for _, file := range files {
+		var p = "/b/" + file
+		nodes[p] = pixelapi.FilesystemNode{Type: "file", Path: p, Name: p[strings.LastIndex(p, "/")+1:], FileSize: 1}
+		for p = p[:strings.LastIndex(p, "/")]; p != "/b"; p = p[:strings.LastIndex(p, "/")] {
+			nodes[p] = pixelapi.FilesystemNode{Type: "dir", Path: p, Name: p[strings.LastIndex(p, "/")+1:]}
+		}
+	}
+
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/filesystem"))
+		node, ok := nodes[p]
+		if err != nil || r.Method != "GET" || !r.URL.Query().Has("stat") {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			http.Error(w, `{"success":false,"value":"method_not_allowed"}`, http.StatusMethodNotAllowed)
+			return
+		} else if !ok {
+			http.Error(w, `{"success":false,"value":"path_not_found"}`, http.StatusNotFound)
+			return
+		}
+
+		var resp = pixelapi.FilesystemPath{Path: []pixelapi.FilesystemNode{node}}
+		for k, child := range nodes {
+			if strings.HasPrefix(k, p+"/") && !strings.Contains(k[len(p)+1:], "/") {
+				resp.Children = append(resp.Children, child)
+			}
+		}
+		sort.Slice(resp.Children, func(i, j int) bool { return resp.Children[i].Name < resp.Children[j].Name })
+		writeJSON(t, w, resp)
+	}))
+	t.Cleanup(srv.Close)
+
+	var api = pixelapi.New(srv.URL)
+	return &api
+}
+
+func writeJSON(t *testing.T, w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		t.Error(err)
+	}
+}
+
+// list requests a listing of bucket "b" with the given query parameters
+func list(t *testing.T, api *pixelapi.PixelAPI, query string) (resp listObjectsResult, serr *s3Error) {
+	var w = httptest.NewRecorder()
+	if serr = listObjects(w, httptest.NewRequest("GET", "/b?list-type=2&"+query, nil), api, "b"); serr != nil {
+		return resp, serr
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode listing: %s", err)
+	}
+	return resp, nil
+}
+
+func (r listObjectsResult) keys() (keys []string) {
+	for _, o := range r.Contents {
+		keys = append(keys, o.Key)
+	}
+	return keys
+}
+
+func (r listObjectsResult) prefixes() (prefixes []string) {
+	for _, p := range r.CommonPrefixes {
+		prefixes = append(prefixes, p.Prefix)
+	}
+	return prefixes
+}
+
+func TestListObjects(t *testing.T) {
+	var api = newListAPI(t,
+		"a.txt", "dir/b.txt", "dir/c.txt", "dir/sub/d.txt", "dir2/e.txt", "f.txt", "photos/2024/g.jpg",
+	)
+
+	var tests = []struct {
+		name      string
+		query     string
+		keys      []string
+		prefixes  []string
+		truncated bool
+	}{{
+		name:  "everything",
+		query: "",
+		keys:  []string{"a.txt", "dir/b.txt", "dir/c.txt", "dir/sub/d.txt", "dir2/e.txt", "f.txt", "photos/2024/g.jpg"},
+	}, {
+		name:  "prefix directory",
+		query: "prefix=dir/",
+		keys:  []string{"dir/b.txt", "dir/c.txt", "dir/sub/d.txt"},
+	}, {
+		name:  "prefix partial name",
+		query: "prefix=dir",
+		keys:  []string{"dir/b.txt", "dir/c.txt", "dir/sub/d.txt", "dir2/e.txt"},
+	}, {
+		name:  "prefix file name",
+		query: "prefix=dir/c",
+		keys:  []string{"dir/c.txt"},
+	}, {
+		name:  "prefix does not exist",
+		query: "prefix=nothing/here",
+	}, {
+		name:     "delimiter",
+		query:    "delimiter=/",
+		keys:     []string{"a.txt", "f.txt"},
+		prefixes: []string{"dir/", "dir2/", "photos/"},
+	}, {
+		name:     "delimiter with prefix",
+		query:    "delimiter=/&prefix=dir/",
+		keys:     []string{"dir/b.txt", "dir/c.txt"},
+		prefixes: []string{"dir/sub/"},
+	}, {
+		name:     "delimiter with partial prefix",
+		query:    "delimiter=/&prefix=di",
+		prefixes: []string{"dir/", "dir2/"},
+	}, {
+		name:     "other delimiter",
+		query:    "delimiter=.",
+		prefixes: []string{"a.", "dir/b.", "dir/c.", "dir/sub/d.", "dir2/e.", "f.", "photos/2024/g."},
+	}, {
+		name:      "max keys",
+		query:     "max-keys=2",
+		keys:      []string{"a.txt", "dir/b.txt"},
+		truncated: true,
+	}, {
+		name:      "max keys with delimiter",
+		query:     "max-keys=2&delimiter=/",
+		keys:      []string{"a.txt"},
+		prefixes:  []string{"dir/"},
+		truncated: true,
+	}, {
+		name:  "start after",
+		query: "start-after=dir/sub/d.txt",
+		keys:  []string{"dir2/e.txt", "f.txt", "photos/2024/g.jpg"},
+	}, {
+		name:     "start after with delimiter",
+		query:    "start-after=dir/&delimiter=/",
+		keys:     []string{"f.txt"},
+		prefixes: []string{"dir2/", "photos/"},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, serr := list(t, api, test.query)
+			if serr != nil {
+				t.Fatalf("unexpected error: %s", serr)
+			}
+			if !reflect.DeepEqual(resp.keys(), test.keys) {
+				t.Errorf("expected keys %v, got %v", test.keys, resp.keys())
+			}
+			if !reflect.DeepEqual(resp.prefixes(), test.prefixes) {
+				t.Errorf("expected prefixes %v, got %v", test.prefixes, resp.prefixes())
+			}
+			if resp.IsTruncated != test.truncated {
+				t.Errorf("expected truncated %t, got %t", test.truncated, resp.IsTruncated)
+			} else if resp.KeyCount != len(test.keys)+len(test.prefixes) {
+				t.Errorf("expected key count %d, got %d", len(test.keys)+len(test.prefixes), resp.KeyCount)
+			}
+		})
+	}
+}
+
+func TestListObjectsContinuationToken(t *testing.T) {
+	var api = newListAPI(t,
+		"a.txt", "dir/b.txt", "dir/c.txt", "dir/sub/d.txt", "dir2/e.txt", "f.txt", "photos/2024/g.jpg",
+	)
+
+	for _, query := range []string{"", "delimiter=/", "prefix=dir", "prefix=dir/&delimiter=/"} {
+		t.Run(query, func(t *testing.T) {
+			all, serr := list(t, api, query)
+			if serr != nil {
+				t.Fatalf("unexpected error: %s", serr)
+			}
+
+			var keys, prefixes []string
+			var token string
+			for pages := 0; ; pages++ {
+				if pages > 10 {
+					t.Fatal("listing does not end")
+				}
+				var q = query + "&max-keys=2"
+				if token != "" {
+					q += "&continuation-token=" + url.QueryEscape(token)
+				}
+				resp, serr := list(t, api, q)
+				if serr != nil {
+					t.Fatalf("unexpected error: %s", serr)
+				} else if resp.ContinuationToken != token {
+					t.Fatalf("expected continuation token %q in response, got %q", token, resp.ContinuationToken)
+				}
+				keys = append(keys, resp.keys()...)
+				prefixes = append(prefixes, resp.prefixes()...)
+				if !resp.IsTruncated {
+					if resp.NextContinuationToken != "" {
+						t.Fatalf("last page has a continuation token")
+					}
+					break
+				}
+				token = resp.NextContinuationToken
+			}
+
+			if !reflect.DeepEqual(keys, all.keys()) || !reflect.DeepEqual(prefixes, all.prefixes()) {
+				t.Fatalf("paged listing returned %v %v, expected %v %v", keys, prefixes, all.keys(), all.prefixes())
+			}
+		})
+	}
+}
+
+func TestListObjectsURLEncoding(t *testing.T) {
+	var api = newListAPI(t, "my photos/a+b.jpg")
+	resp, serr := list(t, api, "encoding-type=url&delimiter=/")
+	if serr != nil {
+		t.Fatalf("unexpected error: %s", serr)
+	} else if p := resp.prefixes(); len(p) != 1 || p[0] != "my%20photos/" {
+		t.Fatalf("expected encoded prefix, got %v", p)
+	}
+
+	resp, serr = list(t, api, "encoding-type=url&prefix=my+photos/")
+	if serr != nil {
+		t.Fatalf("unexpected error: %s", serr)
+	} else if k := resp.keys(); len(k) != 1 || k[0] != "my%20photos/a%2Bb.jpg" {
+		t.Fatalf("expected encoded key, got %v", k)
+	} else if resp.Prefix != "my%20photos/" {
+		t.Fatalf("expected encoded prefix, got %q", resp.Prefix)
+	}
+}
+
+func TestListObjectsErrors(t *testing.T) {
+	var api = newListAPI(t, "a.txt")
+	var tests = []struct {
+		name   string
+		bucket string
+		query  string
+		err    *s3Error
+	}{
+		{"missing bucket", "nope", "", errNoSuchBucket},
+		{"missing bucket with prefix", "nope", "prefix=dir/", errNoSuchBucket},
+		{"bad continuation token", "b", "continuation-token=%25%25", errInvalidArgument},
+		{"bad max keys", "b", "max-keys=-1", errInvalidArgument},
+		{"bad encoding type", "b", "encoding-type=base64", errInvalidArgument},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var req = httptest.NewRequest("GET", "/"+test.bucket+"?list-type=2&"+test.query, nil)
+			var serr = listObjects(httptest.NewRecorder(), req, api, test.bucket)
+			if serr == nil || serr.Code != test.err.Code {
+				t.Fatalf("expected error %s, got %v", test.err.Code, serr)
+			}
+		})
+	}
+}
@@ -0,0 +1,398 @@
+package s3gw
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"fornaxian.tech/pixeldrain_api_client/pixelapi"
+)
+
+// metaPrefix is the header prefix of user defined object metadata. Metadata is
+// stored in the properties of the filesystem node
+const metaPrefix = "X-Amz-Meta-"
+
+// statObject returns the node of an object. Directories are not objects
+func statObject(api *pixelapi.PixelAPI, bucket, key string) (node pixelapi.FilesystemNode, fsp pixelapi.FSPath, serr *s3Error) {
+	if fsp, serr = objectPath(bucket, key); serr != nil {
+		return node, fsp, serr
+	}
+	node, err := api.StatFilesystemPath(fsp.String())
+	if err != nil {
+		return node, fsp, apiError(err, errNoSuchKey)
+	} else if node.IsDir() {
+		return node, fsp, errNoSuchKey
+	}
+	return node, fsp, nil
+}
+
+// objectHeaders sets the headers describing an object
+func objectHeaders(h http.Header, node pixelapi.FilesystemNode) {
+	var contentType = node.FileType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	h.Set("Content-Type", contentType)
+	h.Set("ETag", etag(node))
+	h.Set("Last-Modified", node.Modified.UTC().Format(http.TimeFormat))
+	h.Set("Accept-Ranges", "bytes")
+	for key, value := range node.Properties {
+		h.Set(metaPrefix+key, value)
+	}
+}
+
+// checkPreconditions evaluates the conditional request headers. It returns
+// true if the object should not be sent because it was not modified
+func checkPreconditions(r *http.Request, node pixelapi.FilesystemNode) (notModified bool, err *s3Error) {
+	var tag = etag(node)
+	if match := r.Header.Get("If-Match"); match != "" && match != "*" && !etagMatches(match, tag) {
+		return false, errPreconditionFailed
+	}
+	if t, err := http.ParseTime(r.Header.Get("If-Unmodified-Since")); err == nil && node.Modified.Truncate(time.Second).After(t) {
+		return false, errPreconditionFailed
+	}
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		return match == "*" || etagMatches(match, tag), nil
+	}
+	if t, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !node.Modified.Truncate(time.Second).After(t) {
+		return true, nil
+	}
+	return false, nil
+}
+
+// etagMatches checks if an ETag is in a comma separated list of ETags
+func etagMatches(list, tag string) bool {
+	for _, t := range strings.Split(list, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(t), "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRange parses a single byte range header. If the header is missing or
+// can't be parsed the whole object is returned, like S3 does
+func parseRange(header string, size int64) (offset, length int64, partial bool, err *s3Error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, size, false, nil
+	}
+	first, last, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, size, false, nil
+	}
+
+	if first == "" {
+		// Suffix range, the last n bytes
+		n, perr := strconv.ParseInt(last, 10, 64)
+		if perr != nil || n <= 0 {
+			return 0, size, false, nil
+		} else if size == 0 {
+			return 0, 0, false, errInvalidRange
+		}
+		n = min(n, size)
+		return size - n, n, true, nil
+	}
+
+	start, perr := strconv.ParseInt(first, 10, 64)
+	if perr != nil || start < 0 {
+		return 0, size, false, nil
+	} else if start >= size {
+		return 0, 0, false, errInvalidRange
+	}
+	var end = size - 1
+	if last != "" {
+		if end, perr = strconv.ParseInt(last, 10, 64); perr != nil || end < start {
+			return 0, size, false, nil
+		}
+		end = min(end, size-1)
+	}
+	return start, end - start + 1, true, nil
+}
+
+func getObject(w http.ResponseWriter, r *http.Request, api *pixelapi.PixelAPI, bucket, key string) *s3Error {
+	node, fsp, serr := statObject(api, bucket, key)
+	if serr != nil {
+		return serr
+	}
+	notModified, serr := checkPreconditions(r, node)
+	if serr != nil {
+		return serr
+	}
+	objectHeaders(w.Header(), node)
+	if notModified {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	var size = int64(node.FileSize)
+	offset, length, partial, serr := parseRange(r.Header.Get("Range"), size)
+	if serr != nil {
+		w.Header().Set("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+		return serr
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	var status = http.StatusOK
+	if partial {
+		status = http.StatusPartialContent
+		w.Header().Set("Content-Range", "bytes "+strconv.FormatInt(offset, 10)+"-"+
+			strconv.FormatInt(offset+length-1, 10)+"/"+strconv.FormatInt(size, 10))
+	}
+
+	if r.Method == http.MethodHead || length == 0 {
+		w.WriteHeader(status)
+		return nil
+	}
+
+	file, err := api.OpenFilesystemFile(fsp.String(), pixelapi.FilesystemReadOptions{
+		Offset: offset,
+		Length: length,
+	})
+	if err != nil {
+		w.Header().Del("Content-Length")
+		w.Header().Del("Content-Range")
+		return apiError(err, errNoSuchKey)
+	}
+	defer file.Close()
+
+	w.WriteHeader(status)
+	// The status is already sent, so errors can't be reported anymore. The
+	// client will notice that the body is too short
+	io.Copy(w, file)
+	return nil
+}
+
+// objectMetadata returns the user metadata headers of a request
+func objectMetadata(h http.Header) map[string]string {
+	var meta map[string]string
+	for name, values := range h {
+		if key, ok := strings.CutPrefix(name, metaPrefix); ok && len(values) > 0 {
+			if meta == nil {
+				meta = make(map[string]string)
+			}
+			meta[strings.ToLower(key)] = values[0]
+		}
+	}
+	return meta
+}
+
+func putObject(w http.ResponseWriter, r *http.Request, api *pixelapi.PixelAPI, body io.Reader, bucket, key string) *s3Error {
+	fsp, serr := objectPath(bucket, key)
+	if serr != nil {
+		return serr
+	} else if len(fsp.Segments()) < 2 {
+		return errInvalidArgument.withMessage("Object key is empty")
+	}
+
+	// An empty object with a key ending in a slash is how S3 clients create
+	// folders
+	if strings.HasSuffix(key, "/") {
+		if n, _ := io.ReadFull(body, make([]byte, 1)); n > 0 {
+			return errInvalidArgument.withMessage("Folder objects must be empty")
+		}
+		if _, err := api.MkdirAllFilesystem(fsp.String()); err != nil {
+			return apiError(err, errNoSuchBucket)
+		}
+		w.Header().Set("ETag", `"`+emptySHA256+`"`)
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	if dst, err := api.StatFilesystemPath(fsp.String()); err == nil && dst.IsDir() {
+		return errInvalidArgument.withMessage("Object key is a folder")
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return apiError(err, errNoSuchBucket)
+	}
+
+	// The payload checksum and chunk signatures are only verified when the
+	// whole body has been read. The data is uploaded next to the object first,
+	// so the object is only replaced with data the client actually signed
+	tmp, serr := tempObjectPath(fsp, "upload")
+	if serr != nil {
+		return serr
+	}
+	uploaded, err := api.PutFilesystemFile(tmp.String(), body, pixelapi.FilesystemUploadOptions{
+		MakeParents: true,
+		Overwrite:   pixelapi.OverwriteReplace,
+		Properties:  objectMetadata(r.Header),
+	})
+	if err != nil {
+		return removeTempObject(api, tmp, apiError(err, errNoSuchBucket))
+	}
+	node, serr := replaceObject(api, tmp, fsp)
+	if serr != nil {
+		return serr
+	}
+	if node.SHA256Sum == "" {
+		node.SHA256Sum = uploaded.SHA256Sum
+	}
+	w.Header().Set("ETag", etag(node))
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+type copyObjectResult struct {
+	XMLName      xml.Name  `xml:"CopyObjectResult"`
+	Xmlns        string    `xml:"xmlns,attr"`
+	ETag         string    `xml:"ETag"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+// copyObject copies an object on the server. The target is replaced if it
+// exists. The metadata is always copied from the source object
+func copyObject(w http.ResponseWriter, r *http.Request, api *pixelapi.PixelAPI, bucket, key string) *s3Error {
+	source, err := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		return errInvalidArgument.withMessage("Invalid copy source")
+	}
+	source, _, _ = strings.Cut(source, "?versionId=")
+	srcBucket, srcKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+
+	srcNode, srcPath, serr := statObject(api, srcBucket, srcKey)
+	if serr != nil {
+		return serr
+	}
+	if match := r.Header.Get("X-Amz-Copy-Source-If-Match"); match != "" && !etagMatches(match, etag(srcNode)) {
+		return errPreconditionFailed
+	}
+	if match := r.Header.Get("X-Amz-Copy-Source-If-None-Match"); match != "" && etagMatches(match, etag(srcNode)) {
+		return errPreconditionFailed
+	}
+
+	dstPath, serr := objectPath(bucket, key)
+	if serr != nil {
+		return serr
+	} else if len(dstPath.Segments()) < 2 || strings.HasSuffix(key, "/") {
+		return errInvalidArgument.withMessage("Invalid copy target")
+	}
+	if dstPath.String() == srcPath.String() {
+		// S3 allows this to change metadata, which is not supported
+		return errNotImplemented
+	}
+
+	if len(dstPath.Segments()) > 2 {
+		if _, err = api.MkdirAllFilesystem(dstPath.Parent().String()); err != nil {
+			return apiError(err, errNoSuchBucket)
+		}
+	}
+
+	// The API does not overwrite when copying. When the target exists the
+	// object is copied next to it first, so the old object is only removed
+	// when the copy succeeded
+	var exists bool
+	if dst, err := api.StatFilesystemPath(dstPath.String()); err == nil {
+		if dst.IsDir() {
+			return errInvalidArgument.withMessage("Copy target is a folder")
+		}
+		exists = true
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return apiError(err, errNoSuchBucket)
+	}
+	var node pixelapi.FilesystemNode
+	if exists {
+		var tmp pixelapi.FSPath
+		if tmp, serr = tempObjectPath(dstPath, "copy"); serr != nil {
+			return serr
+		} else if _, err = api.CopyFilesystemPath(srcPath.String(), tmp.String()); err != nil {
+			return apiError(err, errNoSuchKey)
+		}
+		node, serr = replaceObject(api, tmp, dstPath)
+	} else if node, err = api.CopyFilesystemPath(srcPath.String(), dstPath.String()); err != nil {
+		serr = apiError(err, errNoSuchKey)
+	}
+	if serr != nil {
+		return serr
+	}
+	if node.SHA256Sum == "" {
+		node.SHA256Sum = srcNode.SHA256Sum
+	}
+	if node.Modified.IsZero() {
+		node.Modified = time.Now()
+	}
+
+	return writeXML(w, http.StatusOK, copyObjectResult{
+		Xmlns:        s3Namespace,
+		ETag:         etag(node),
+		LastModified: node.Modified.UTC(),
+	})
+}
+
+// tempObjectPath returns a hidden path next to an object. A new version of the
+// object is written there first and moved over the object when it's complete,
+// so the object is left alone when writing the new version fails
+func tempObjectPath(dst pixelapi.FSPath, kind string) (pixelapi.FSPath, *s3Error) {
+	var suffix = make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return dst, errInternalError
+	}
+	tmp, err := dst.Parent().Join("." + dst.Base() + "." + kind + "-" + hex.EncodeToString(suffix))
+	if err != nil {
+		return dst, errInternalError
+	}
+	return tmp, nil
+}
+
+// replaceObject moves the complete temporary object tmp to dst. The API does
+// not overwrite when moving, so an existing object at dst is deleted first. If
+// that fails tmp is removed. If the final move fails tmp is kept under the
+// temporary name so the data is not lost
+func replaceObject(api *pixelapi.PixelAPI, tmp, dst pixelapi.FSPath) (node pixelapi.FilesystemNode, serr *s3Error) {
+	err := api.DeleteFilesystemPath(dst.String(), false)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return node, removeTempObject(api, tmp, apiError(err, errNoSuchKey))
+	}
+	if node, err = api.MoveFilesystemPathTo(tmp.String(), dst.String()); err != nil {
+		return node, apiError(err, errNoSuchKey)
+	}
+	return node, nil
+}
+
+// removeTempObject removes a temporary object after an operation failed with
+// serr. If it can't be removed an internal error naming it is returned
+// instead, so it's logged and can be cleaned up by hand
+func removeTempObject(api *pixelapi.PixelAPI, tmp pixelapi.FSPath, serr *s3Error) *s3Error {
+	err := api.DeleteFilesystemPath(tmp.String(), false)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return errInternalError.withMessage(fmt.Sprintf(
+			"%s. Failed to remove temporary object %s: %s", serr.Message, tmp, err,
+		))
+	}
+	return serr
+}
+
+// deleteObject deletes an object. Like S3, deleting an object which does not
+// exist is not an error. Keys ending with a slash delete empty directories,
+// directories which are not empty are left alone
+func deleteObject(w http.ResponseWriter, api *pixelapi.PixelAPI, bucket, key string) *s3Error {
+	fsp, serr := objectPath(bucket, key)
+	if serr != nil {
+		return serr
+	} else if len(fsp.Segments()) < 2 {
+		return errInvalidArgument.withMessage("Object key is empty")
+	}
+
+	node, err := api.StatFilesystemPath(fsp.String())
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return apiError(err, errNoSuchKey)
+	case node.IsDir() != strings.HasSuffix(key, "/"):
+		// A file can't be deleted as a folder and the other way around
+	default:
+		if err = api.DeleteFilesystemPath(fsp.String(), false); err != nil &&
+			!errors.Is(err, fs.ErrNotExist) && !pixelapi.ErrIsNotEmpty(err) {
+			return apiError(err, errNoSuchKey)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,405 @@
+package s3gw
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Credential is an S3 secret key and the pixeldrain API key requests signed
+// with it are executed with
+type Credential struct {
+	SecretKey string `json:"secret_key"`
+	APIKey    string `json:"api_key"`
+}
+
+const (
+	sigAlgorithm    = "AWS4-HMAC-SHA256"
+	amzDateFormat   = "20060102T150405Z"
+	maxClockSkew    = 15 * time.Minute
+	maxPresignedAge = 7 * 24 * time.Hour
+
+	unsignedPayload          = "UNSIGNED-PAYLOAD"
+	streamingPayload         = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	streamingPayloadTrailer  = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+	streamingUnsignedTrailer = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+)
+
+// now returns the current time. Tests replace it to check signatures from the
+// past
+var now = time.Now
+
+// emptySHA256 is the hex encoded SHA-256 checksum of no data
+var emptySHA256 = hex.EncodeToString(sha256.New().Sum(nil))
+
+// sigV4 is a parsed AWS Signature Version 4 from a request header or query
+type sigV4 struct {
+	accessKey string
+	date      string // Date part of the credential scope, like 20060102
+	scope     string // The credential scope without the access key
+	headers   []string
+	signature string
+	time      time.Time
+	payload   string // Value of x-amz-content-sha256
+	presigned bool
+}
+
+// parseSigV4 reads the signature from the Authorization header, or from the
+// query parameters of a presigned URL
+func parseSigV4(r *http.Request) (sig sigV4, err *s3Error) {
+	var credential, signedHeaders, amzDate string
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if !strings.HasPrefix(auth, sigAlgorithm+" ") {
+			return sig, errAuthorizationHeaderMalformed
+		}
+		for _, part := range strings.Split(strings.TrimPrefix(auth, sigAlgorithm+" "), ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			switch key {
+			case "Credential":
+				credential = value
+			case "SignedHeaders":
+				signedHeaders = value
+			case "Signature":
+				sig.signature = value
+			}
+		}
+		amzDate = r.Header.Get("X-Amz-Date")
+		if amzDate == "" {
+			if t, err := http.ParseTime(r.Header.Get("Date")); err == nil {
+				amzDate = t.UTC().Format(amzDateFormat)
+			}
+		}
+		sig.payload = r.Header.Get("X-Amz-Content-Sha256")
+		if sig.payload == "" {
+			return sig, errMissingContentSHA256
+		}
+	} else if q := r.URL.Query(); q.Get("X-Amz-Algorithm") != "" {
+		if q.Get("X-Amz-Algorithm") != sigAlgorithm {
+			return sig, errAuthorizationQueryMalformed
+		}
+		credential = q.Get("X-Amz-Credential")
+		signedHeaders = q.Get("X-Amz-SignedHeaders")
+		sig.signature = q.Get("X-Amz-Signature")
+		amzDate = q.Get("X-Amz-Date")
+		sig.presigned = true
+		sig.payload = q.Get("X-Amz-Content-Sha256")
+		if sig.payload == "" {
+			sig.payload = unsignedPayload
+		}
+	} else {
+		return sig, errAccessDenied
+	}
+
+	// The credential looks like AKID/20060102/region/s3/aws4_request
+	var scope = strings.Split(credential, "/")
+	if len(scope) != 5 || scope[3] != "s3" || scope[4] != "aws4_request" ||
+		signedHeaders == "" || sig.signature == "" {
+		return sig, errAuthorizationHeaderMalformed
+	}
+	sig.accessKey, sig.date = scope[0], scope[1]
+	sig.scope = strings.Join(scope[1:], "/")
+	sig.headers = strings.Split(signedHeaders, ";")
+
+	// Without these the signature would not cover the host the request was
+	// meant for, or the checksum of the payload. Presigned URLs put the
+	// checksum in the query, which is always signed
+	if !slices.Contains(sig.headers, "host") {
+		if sig.presigned {
+			return sig, errAuthorizationQueryMalformed.withMessage("X-Amz-SignedHeaders must include host")
+		}
+		return sig, errAuthorizationHeaderMalformed.withMessage("SignedHeaders must include host")
+	} else if !sig.presigned && !slices.Contains(sig.headers, "x-amz-content-sha256") {
+		return sig, errAuthorizationHeaderMalformed.withMessage("SignedHeaders must include x-amz-content-sha256")
+	}
+
+	var perr error
+	if sig.time, perr = time.Parse(amzDateFormat, amzDate); perr != nil {
+		return sig, errAccessDenied.withMessage("Missing or invalid request date")
+	} else if sig.time.Format("20060102") != sig.date {
+		return sig, errAuthorizationHeaderMalformed
+	}
+
+	if sig.presigned {
+		expires, perr := strconv.Atoi(r.URL.Query().Get("X-Amz-Expires"))
+		if perr != nil || expires < 0 || time.Duration(expires)*time.Second > maxPresignedAge {
+			return sig, errAuthorizationQueryMalformed
+		}
+		if now().After(sig.time.Add(time.Duration(expires) * time.Second)) {
+			return sig, errAccessDenied.withMessage("Request has expired")
+		}
+	} else if d := now().Sub(sig.time); d > maxClockSkew || d < -maxClockSkew {
+		return sig, errRequestTimeTooSkewed
+	}
+	return sig, nil
+}
+
+// signingKey derives the key used to sign requests on a day
+func signingKey(secret, scope string) []byte {
+	var key = []byte("AWS4" + secret)
+	for _, part := range strings.Split(scope, "/") {
+		key = hmacSHA256(key, part)
+	}
+	return key
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	var mac = hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data string) string {
+	var sum = sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// verify checks the signature of a request with the secret key
+func (sig sigV4) verify(r *http.Request, secret string) (key []byte, err *s3Error) {
+	// Go moves the host header out of the header map, so it's taken from the
+	// request
+	var canonicalHeaders strings.Builder
+	for _, name := range sig.headers {
+		var value string
+		switch name {
+		case "host":
+			value = r.Host
+		default:
+			var values []string
+			for _, v := range r.Header.Values(name) {
+				values = append(values, strings.Join(strings.Fields(v), " "))
+			}
+			value = strings.Join(values, ",")
+		}
+		canonicalHeaders.WriteString(name + ":" + value + "\n")
+	}
+
+	var canonicalRequest = strings.Join([]string{
+		r.Method,
+		uriEncode(r.URL.Path, false),
+		canonicalQuery(r.URL.Query(), sig.presigned),
+		canonicalHeaders.String(),
+		strings.Join(sig.headers, ";"),
+		sig.payload,
+	}, "\n")
+
+	var stringToSign = strings.Join([]string{
+		sigAlgorithm,
+		sig.time.Format(amzDateFormat),
+		sig.scope,
+		sha256Hex(canonicalRequest),
+	}, "\n")
+
+	key = signingKey(secret, sig.scope)
+	var expected = hex.EncodeToString(hmacSHA256(key, stringToSign))
+	if !hmac.Equal([]byte(expected), []byte(sig.signature)) {
+		return nil, errSignatureDoesNotMatch
+	}
+	return key, nil
+}
+
+// canonicalQuery returns the sorted and encoded query string of a request. The
+// signature itself is left out of presigned requests
+func canonicalQuery(query url.Values, presigned bool) string {
+	var params []string
+	for key, values := range query {
+		if presigned && key == "X-Amz-Signature" {
+			continue
+		}
+		for _, value := range values {
+			params = append(params, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// uriEncode encodes a string the way AWS does for signatures. All bytes except
+// the unreserved characters are percent encoded. Slashes are only encoded if
+// encodeSlash is true
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		var c = s[i]
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// payloadReader returns a reader for the request body which checks the payload
+// as described by x-amz-content-sha256. Streaming payloads are decoded from the
+// aws-chunked encoding
+func (sig sigV4) payloadReader(r *http.Request, key []byte) (io.Reader, *s3Error) {
+	switch sig.payload {
+	case unsignedPayload:
+		return r.Body, nil
+	case streamingPayload, streamingPayloadTrailer:
+		return &chunkedReader{
+			r:          bufio.NewReader(r.Body),
+			key:        key,
+			prefix:     "AWS4-HMAC-SHA256-PAYLOAD\n" + sig.time.Format(amzDateFormat) + "\n" + sig.scope + "\n",
+			previous:   sig.signature,
+			hash:       sha256.New(),
+			hasTrailer: sig.payload == streamingPayloadTrailer,
+		}, nil
+	case streamingUnsignedTrailer:
+		return &chunkedReader{r: bufio.NewReader(r.Body), hasTrailer: true}, nil
+	}
+
+	if _, err := hex.DecodeString(sig.payload); err != nil || len(sig.payload) != 64 {
+		return nil, errInvalidContentSHA256
+	}
+	return &digestReader{r: r.Body, hash: sha256.New(), expected: strings.ToLower(sig.payload)}, nil
+}
+
+// digestReader checks the SHA-256 checksum of the data read through it when
+// the end is reached
+type digestReader struct {
+	r        io.Reader
+	hash     hash.Hash
+	expected string
+}
+
+func (d *digestReader) Read(p []byte) (n int, err error) {
+	n, err = d.r.Read(p)
+	d.hash.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(d.hash.Sum(nil)) != d.expected {
+		return n, errContentSHA256Mismatch
+	}
+	return n, err
+}
+
+// chunkedReader decodes a body in the aws-chunked encoding. If key is set the
+// signature of every chunk is verified when the chunk has been read. Trailing
+// headers are read but not verified
+type chunkedReader struct {
+	r          *bufio.Reader
+	key        []byte
+	prefix     string // First part of the string to sign for every chunk
+	previous   string // Signature of the previous chunk
+	hash       hash.Hash
+	hasTrailer bool
+
+	remaining int64  // Bytes left in the current chunk
+	signature string // Signature of the current chunk
+	err       error
+}
+
+var errChunkEncoding = errors.New("invalid aws-chunked encoding")
+
+func (c *chunkedReader) Read(p []byte) (n int, err error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.remaining == 0 {
+		if c.err = c.nextChunk(); c.err != nil {
+			return 0, c.err
+		}
+	}
+
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err = c.r.Read(p)
+	c.remaining -= int64(n)
+	if c.hash != nil {
+		c.hash.Write(p[:n])
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	} else if err == nil && c.remaining == 0 {
+		err = c.endChunk()
+	}
+	c.err = err
+	return n, err
+}
+
+// nextChunk reads a chunk header. The last chunk has size zero, after reading
+// it the trailer is skipped and io.EOF is returned
+func (c *chunkedReader) nextChunk() error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	size, params, _ := strings.Cut(line, ";")
+	c.remaining, err = strconv.ParseInt(size, 16, 64)
+	if err != nil || c.remaining < 0 {
+		return errChunkEncoding
+	}
+	c.signature = strings.TrimPrefix(params, "chunk-signature=")
+
+	if c.remaining > 0 {
+		return nil
+	}
+
+	// The final chunk is empty, but it's still signed
+	if err = c.verifyChunk(); err != nil {
+		return err
+	}
+	if c.hasTrailer {
+		for {
+			if line, err = c.readLine(); err != nil {
+				return err
+			} else if line == "" {
+				break
+			}
+		}
+	}
+	return io.EOF
+}
+
+// endChunk reads the line break after the data of a chunk and checks the
+// chunk signature
+func (c *chunkedReader) endChunk() error {
+	if line, err := c.readLine(); err != nil {
+		return err
+	} else if line != "" {
+		return errChunkEncoding
+	}
+	return c.verifyChunk()
+}
+
+func (c *chunkedReader) verifyChunk() error {
+	if c.key == nil {
+		return nil
+	}
+	var expected = hex.EncodeToString(hmacSHA256(
+		c.key,
+		c.prefix+c.previous+"\n"+emptySHA256+"\n"+hex.EncodeToString(c.hash.Sum(nil)),
+	))
+	if !hmac.Equal([]byte(expected), []byte(c.signature)) {
+		return errSignatureDoesNotMatch
+	}
+	c.previous = c.signature
+	c.hash.Reset()
+	return nil
+}
+
+func (c *chunkedReader) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err == io.EOF {
+		return "", io.ErrUnexpectedEOF
+	} else if err != nil {
+		return "", err
+	} else if !strings.HasSuffix(line, "\r\n") {
+		return "", errChunkEncoding
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
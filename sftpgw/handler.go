@@ -0,0 +1,393 @@
+package sftpgw
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"fornaxian.tech/pixeldrain_api_client/pixelapi"
+	"github.com/pkg/sftp"
+)
+
+// maxPending is the amount of data which can be buffered while waiting for an
+// earlier write to arrive
+const maxPending = 64 << 20
+
+var errNonSequential = errors.New("writes must be sequential, resuming uploads is not supported")
+
+// handler implements the sftp request handlers for a single session
+type handler struct {
+	api  *pixelapi.PixelAPI
+	root pixelapi.FSPath
+}
+
+func newHandlers(api *pixelapi.PixelAPI, root pixelapi.FSPath) sftp.Handlers {
+	var h = &handler{api: api, root: root}
+	return sftp.Handlers{FileGet: h, FilePut: h, FileCmd: h, FileList: h}
+}
+
+// sftpError converts an API error to an error the sftp package turns into the
+// right status code
+func sftpError(err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return os.ErrNotExist
+	case errors.Is(err, fs.ErrPermission):
+		return sftp.ErrSSHFxPermissionDenied
+	}
+	return err
+}
+
+// resolve converts a path from a request to a filesystem path
+func (h *handler) resolve(name string) (pixelapi.FSPath, error) {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if name == "" {
+		return h.root, nil
+	}
+	fsp, err := h.root.Join(strings.Split(name, "/")...)
+	if err != nil {
+		return fsp, fmt.Errorf("%w: %s", sftp.ErrSSHFxBadMessage, err)
+	}
+	return fsp, nil
+}
+
+// stat returns a node and the permissions the user has on it. The root which
+// contains the buckets can only be read
+func (h *handler) stat(fsp pixelapi.FSPath) (node pixelapi.FilesystemNode, perm pixelapi.Permissions, err error) {
+	if fsp.IsRoot() {
+		return pixelapi.FilesystemNode{Type: "dir", Path: "/", Name: "/"}, pixelapi.Permissions{Read: true}, nil
+	}
+	resp, err := h.api.GetFilesystemPath(fsp.String())
+	if err != nil {
+		return node, perm, sftpError(err)
+	}
+	return resp.Node(), resp.Permissions, nil
+}
+
+// statDir returns the permissions on a directory. It fails if the path is not a
+// directory
+func (h *handler) statDir(fsp pixelapi.FSPath) (perm pixelapi.Permissions, err error) {
+	node, perm, err := h.stat(fsp)
+	if err != nil {
+		return perm, err
+	} else if !node.IsDir() {
+		return perm, fmt.Errorf("%w: %s is not a directory", sftp.ErrSSHFxNoSuchFile, fsp)
+	}
+	return perm, nil
+}
+
+// Fileread implements sftp.FileReader
+func (h *handler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	fsp, err := h.resolve(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	node, perm, err := h.stat(fsp)
+	if err != nil {
+		return nil, err
+	} else if node.IsDir() {
+		return nil, fmt.Errorf("%w: %s is a directory", sftp.ErrSSHFxFailure, fsp)
+	} else if !perm.Read {
+		return nil, sftp.ErrSSHFxPermissionDenied
+	}
+
+	file, err := h.api.OpenFilesystemFileAt(fsp.String())
+	if err != nil {
+		return nil, sftpError(err)
+	}
+	return file, nil
+}
+
+// Filewrite implements sftp.FileWriter. The file is uploaded while it's being
+// written, the upload is finished when the file is closed. An upload always
+// replaces the whole file, so an existing file can only be opened for writing
+// with the truncate flag. Without it the client expects the data it does not
+// overwrite to be kept, which is not possible
+func (h *handler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	var flags = r.Pflags()
+	if flags.Append {
+		return nil, sftp.ErrSSHFxOpUnsupported
+	}
+	fsp, err := h.resolve(r.Filepath)
+	if err != nil {
+		return nil, err
+	} else if len(fsp.Segments()) < 2 {
+		return nil, sftp.ErrSSHFxPermissionDenied
+	}
+
+	node, perm, err := h.stat(fsp)
+	switch {
+	case err == nil && flags.Excl:
+		return nil, fmt.Errorf("%w: %s already exists", sftp.ErrSSHFxFailure, fsp)
+	case err == nil && node.IsDir():
+		return nil, fmt.Errorf("%w: %s is a directory", sftp.ErrSSHFxFailure, fsp)
+	case err == nil && !perm.Write:
+		return nil, sftp.ErrSSHFxPermissionDenied
+	case err == nil && !flags.Trunc:
+		return nil, fmt.Errorf("%w: %s can only be replaced, open it with the truncate flag", sftp.ErrSSHFxOpUnsupported, fsp)
+	case err != nil && !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	case err != nil && !flags.Creat:
+		return nil, err
+	case err != nil:
+		if perm, err = h.statDir(fsp.Parent()); err != nil {
+			return nil, err
+		} else if !perm.Write {
+			return nil, sftp.ErrSSHFxPermissionDenied
+		}
+	}
+
+	pr, pw := io.Pipe()
+	var u = &uploadWriter{pw: pw, pending: make(map[int64][]byte), done: make(chan struct{})}
+	go func() {
+		defer close(u.done)
+		_, u.err = h.api.PutFilesystemFile(fsp.String(), pr, pixelapi.FilesystemUploadOptions{
+			Overwrite: pixelapi.OverwriteReplace,
+		})
+		pr.CloseWithError(u.err)
+	}()
+	return u, nil
+}
+
+// uploadWriter puts writes back in order and streams them to an upload
+type uploadWriter struct {
+	lock        sync.Mutex
+	pw          *io.PipeWriter
+	offset      int64            // Offset of the next byte the upload expects
+	pending     map[int64][]byte // Writes which arrived before the data in front of them
+	pendingSize int64
+
+	done   chan struct{}
+	err    error
+	failed error // The transfer was interrupted, the upload must be aborted
+}
+
+func (u *uploadWriter) WriteAt(b []byte, off int64) (n int, err error) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	defer func() {
+		// The client was told that this write failed, so the file is not
+		// complete even if the client closes it normally
+		if err != nil && u.failed == nil {
+			u.failed = err
+		}
+	}()
+
+	if off != u.offset {
+		if off < u.offset || u.pendingSize+int64(len(b)) > maxPending {
+			return 0, errNonSequential
+		}
+		// The buffer is reused by the sftp package, so it has to be copied
+		u.pending[off] = append([]byte(nil), b...)
+		u.pendingSize += int64(len(b))
+		return len(b), nil
+	}
+
+	if _, err := u.pw.Write(b); err != nil {
+		return 0, err
+	}
+	u.offset += int64(len(b))
+
+	for {
+		next, ok := u.pending[u.offset]
+		if !ok {
+			return len(b), nil
+		}
+		delete(u.pending, u.offset)
+		u.pendingSize -= int64(len(next))
+		if _, err := u.pw.Write(next); err != nil {
+			return 0, err
+		}
+		u.offset += int64(len(next))
+	}
+}
+
+// TransferError implements sftp.TransferError. It's called when the connection
+// is lost while the file is still open, the file is closed after it
+func (u *uploadWriter) TransferError(err error) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if u.failed == nil {
+		u.failed = err
+	}
+}
+
+// Close finishes the upload and returns its error. If the transfer was
+// interrupted the upload is aborted, so a partial file does not replace the
+// existing one
+func (u *uploadWriter) Close() error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if u.failed == nil && len(u.pending) > 0 {
+		u.failed = errNonSequential
+	}
+	if u.failed != nil {
+		u.pw.CloseWithError(fmt.Errorf("upload aborted: %w", u.failed))
+		<-u.done
+		return sftpError(u.failed)
+	}
+	u.pw.Close()
+	<-u.done
+	return sftpError(u.err)
+}
+
+// Filecmd implements sftp.FileCmder
+func (h *handler) Filecmd(r *sftp.Request) error {
+	fsp, err := h.resolve(r.Filepath)
+	if err != nil {
+		return err
+	}
+
+	switch r.Method {
+	case "Setstat":
+		return h.setstat(r, fsp)
+	case "Rename":
+		return h.rename(r, fsp, false)
+	case "Mkdir":
+		if perm, err := h.statDir(fsp.Parent()); err != nil {
+			return err
+		} else if !perm.Write || len(fsp.Segments()) < 2 {
+			return sftp.ErrSSHFxPermissionDenied
+		}
+		if _, _, err = h.stat(fsp); err == nil {
+			return fmt.Errorf("%w: %s already exists", sftp.ErrSSHFxFailure, fsp)
+		}
+		_, err = h.api.MkdirAllFilesystem(fsp.String())
+		return sftpError(err)
+	case "Rmdir", "Remove":
+		node, perm, err := h.stat(fsp)
+		if err != nil {
+			return err
+		} else if node.IsDir() != (r.Method == "Rmdir") {
+			return fmt.Errorf("%w: wrong node type for %s", sftp.ErrSSHFxFailure, r.Method)
+		} else if !perm.Delete || len(fsp.Segments()) < 2 {
+			return sftp.ErrSSHFxPermissionDenied
+		}
+		err = h.api.DeleteFilesystemPath(fsp.String(), false)
+		return sftpError(err)
+	}
+	return sftp.ErrSSHFxOpUnsupported
+}
+
+// PosixRename implements sftp.PosixRenameFileCmder. Unlike a normal rename it
+// replaces an existing file at the target
+func (h *handler) PosixRename(r *sftp.Request) error {
+	fsp, err := h.resolve(r.Filepath)
+	if err != nil {
+		return err
+	}
+	return h.rename(r, fsp, true)
+}
+
+// setstat changes the permission bits of a node. Changing the owner, size or
+// times is not supported. Times are ignored so clients which preserve them
+// don't fail
+func (h *handler) setstat(r *sftp.Request, fsp pixelapi.FSPath) error {
+	var flags = r.AttrFlags()
+	if flags.UidGid || flags.Size {
+		return sftp.ErrSSHFxOpUnsupported
+	}
+	if !flags.Permissions {
+		return nil
+	}
+	if _, perm, err := h.stat(fsp); err != nil {
+		return err
+	} else if !perm.Write {
+		return sftp.ErrSSHFxPermissionDenied
+	}
+	_, err := h.api.ChmodFilesystemPath(fsp.String(), r.Attributes().FileMode())
+	return sftpError(err)
+}
+
+// rename moves a node to the target of the request. If overwrite is true an
+// existing file at the target is replaced, like the rename system call
+func (h *handler) rename(r *sftp.Request, fsp pixelapi.FSPath, overwrite bool) error {
+	target, err := h.resolve(r.Target)
+	if err != nil {
+		return err
+	}
+	if _, perm, err := h.stat(fsp); err != nil {
+		return err
+	} else if !perm.Write || len(fsp.Segments()) < 2 {
+		return sftp.ErrSSHFxPermissionDenied
+	}
+	if perm, err := h.statDir(target.Parent()); err != nil {
+		return err
+	} else if !perm.Write || len(target.Segments()) < 2 {
+		return sftp.ErrSSHFxPermissionDenied
+	}
+
+	if node, perm, err := h.stat(target); err == nil {
+		if !overwrite || node.IsDir() {
+			return fmt.Errorf("%w: %s already exists", sftp.ErrSSHFxFailure, target)
+		} else if !perm.Delete {
+			return sftp.ErrSSHFxPermissionDenied
+		}
+		if err = h.api.DeleteFilesystemPath(target.String(), false); err != nil {
+			return sftpError(err)
+		}
+	}
+
+	_, err = h.api.MoveFilesystemPathTo(fsp.String(), target.String())
+	return sftpError(err)
+}
+
+// Filelist implements sftp.FileLister
+func (h *handler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	fsp, err := h.resolve(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	switch r.Method {
+	case "Stat":
+		node, _, err := h.stat(fsp)
+		if err != nil {
+			return nil, err
+		}
+		return listerAt{node.FileInfo()}, nil
+	case "List":
+		var children []pixelapi.FilesystemNode
+		if fsp.IsRoot() {
+			if children, err = h.api.GetFilesystems(); err != nil {
+				return nil, sftpError(err)
+			}
+		} else {
+			resp, err := h.api.GetFilesystemPath(fsp.String())
+			if err != nil {
+				return nil, sftpError(err)
+			} else if !resp.Node().IsDir() {
+				return nil, fmt.Errorf("%w: %s is not a directory", sftp.ErrSSHFxFailure, fsp)
+			} else if !resp.Permissions.Read {
+				return nil, sftp.ErrSSHFxPermissionDenied
+			}
+			children = resp.Children
+		}
+
+		var list = make(listerAt, len(children))
+		for i := range children {
+			list[i] = children[i].FileInfo()
+		}
+		return list, nil
+	}
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
+
+// listerAt is a fixed list of file infos
+type listerAt []fs.FileInfo
+
+func (l listerAt) ListAt(dst []fs.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	var n = copy(dst, l[offset:])
+	if n < len(dst) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,167 @@
+// Package sftpgw is an SFTP server which serves pixeldrain filesystem buckets.
+// Every SFTP user is mapped to a pixeldrain API key, the files the user can see
+// and change are the files the API key has access to. Permissions are checked
+// against FilesystemPath.Permissions before every operation, so clients get a
+// permission denied status instead of a generic failure.
+//
+// Uploads are streamed to the API while they are written. Clients write files
+// in multiple concurrent requests, those are put back in order before they are
+// uploaded. Writing at random offsets, like resuming an upload, is not
+// supported.
+package sftpgw
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+
+	"fornaxian.tech/pixeldrain_api_client/pixelapi"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// User is an account which can log in to the SFTP server
+type User struct {
+	// Password of the user. Password authentication is disabled for the user
+	// if it's empty
+	Password string `json:"password"`
+
+	// AuthorizedKeys are public keys the user can log in with, in the format
+	// of the OpenSSH authorized_keys file
+	AuthorizedKeys []string `json:"authorized_keys"`
+
+	// APIKey is the pixeldrain API key operations are executed with
+	APIKey string `json:"api_key"`
+
+	// Root is the filesystem path the user sees as "/". If it's empty all
+	// buckets of the user are shown
+	Root string `json:"root"`
+}
+
+// Server is an SFTP server backed by the pixeldrain filesystem API
+type Server struct {
+	api    pixelapi.PixelAPI
+	users  map[string]User
+	config *ssh.ServerConfig
+
+	// Logger receives connection errors. Nothing is logged if it's nil
+	Logger *log.Logger
+}
+
+// New creates an SFTP server. api is the client used for requests, it's
+// logged in with the API key of the user for every connection. users maps user
+// names to accounts and hostKey is the private key the server identifies
+// itself with
+func New(api pixelapi.PixelAPI, users map[string]User, hostKey ssh.Signer) (*Server, error) {
+	var keys = make(map[string]bool) // User name and public key
+	for name, user := range users {
+		if _, err := pixelapi.ParseFSPath(user.Root); err != nil {
+			return nil, fmt.Errorf("user %s: %w", name, err)
+		}
+		for _, line := range user.AuthorizedKeys {
+			key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+			if err != nil {
+				return nil, fmt.Errorf("user %s: invalid authorized key: %w", name, err)
+			}
+			keys[name+"\x00"+string(key.Marshal())] = true
+		}
+	}
+
+	var s = &Server{api: api, users: users}
+	s.config = &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			user, ok := users[conn.User()]
+			if ok && user.Password != "" && subtle.ConstantTimeCompare([]byte(user.Password), password) == 1 {
+				return &ssh.Permissions{}, nil
+			}
+			return nil, errors.New("invalid user name or password")
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if keys[conn.User()+"\x00"+string(key.Marshal())] {
+				return &ssh.Permissions{}, nil
+			}
+			return nil, errors.New("public key not authorized")
+		},
+	}
+	s.config.AddHostKey(hostKey)
+	return s, nil
+}
+
+// ListenAndServe listens on a TCP address and serves SFTP connections
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return s.Serve(l)
+}
+
+// Serve accepts connections on a listener and serves SFTP on them. It returns
+// when the listener fails
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) logf(format string, args ...any) {
+	if s.Logger != nil {
+		s.Logger.Printf(format, args...)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		s.logf("SSH handshake with %s failed: %s", conn.RemoteAddr(), err)
+		return
+	}
+	defer sconn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	var user = s.users[sconn.User()]
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			newChan.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+		channel, requests, err := newChan.Accept()
+		if err != nil {
+			s.logf("Failed to accept channel from %s: %s", sconn.User(), err)
+			continue
+		}
+		go s.serveSession(sconn.User(), user, channel, requests)
+	}
+}
+
+// serveSession waits for the client to request the sftp subsystem and serves
+// it. Shells and commands are refused
+func (s *Server) serveSession(name string, user User, channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	for req := range requests {
+		var ok = req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+		req.Reply(ok, nil)
+		if !ok {
+			continue
+		}
+
+		go ssh.DiscardRequests(requests)
+		var api = s.api.Login(user.APIKey)
+		root, _ := pixelapi.ParseFSPath(user.Root)
+		var server = sftp.NewRequestServer(channel, newHandlers(&api, root))
+		if err := server.Serve(); err != nil && !errors.Is(err, io.EOF) {
+			s.logf("SFTP session of %s failed: %s", name, err)
+		}
+		server.Close()
+		return
+	}
+}